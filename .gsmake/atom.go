@@ -2,7 +2,6 @@ package tasks
 
 import (
 	"os"
-	"os/exec"
 
 	"github.com/gsdocker/gserrors"
 	"github.com/gsmake/gsmake"
@@ -17,21 +16,7 @@ func TaskAtom(runner *gsmake.Runner, args ...string) error {
 		domain = args[0]
 	}
 
-	if err := os.Setenv("GOPATH", runner.RootFS().DomainDir(domain)); err != nil {
-		return gserrors.Newf(err, "set GOPATH error")
-	}
-
-	cmd := exec.Command("atom")
-
-	cmd.Stderr = os.Stderr
-
-	cmd.Stdout = os.Stdout
-
-	cmd.Stdin = os.Stdin
-
-	cmd.Dir = runner.StartDir()
-
-	if err := cmd.Run(); err != nil {
+	if err := runner.Exec("atom").Domain(domain).Dir(runner.StartDir()).Stdin(os.Stdin).Run(); err != nil {
 		return gserrors.Newf(err, "start atom error")
 	}
 
@@ -0,0 +1,28 @@
+package tasks
+
+import (
+	"flag"
+
+	"github.com/gsdocker/gserrors"
+	"github.com/gsmake/gsmake"
+)
+
+// TaskEnv .
+func TaskEnv(runner *gsmake.Runner, args ...string) error {
+
+	var flagset flag.FlagSet
+
+	format := flagset.String("format", "sh", "output format, sh, fish or json")
+
+	if err := flagset.Parse(args); err != nil {
+		return gserrors.Newf(err, "parse env args error")
+	}
+
+	domain := "task"
+
+	if flagset.NArg() != 0 {
+		domain = flagset.Arg(0)
+	}
+
+	return gsmake.PrintEnv(runner.Stdout(), runner.Environ(domain), *format)
+}
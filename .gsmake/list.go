@@ -1,9 +1,39 @@
 package tasks
 
-import "github.com/gsmake/gsmake"
+import (
+	"flag"
+
+	"github.com/gsdocker/gserrors"
+	"github.com/gsmake/gsmake"
+)
 
 // TaskList .
 func TaskList(runner *gsmake.Runner, args ...string) error {
-	runner.PrintTask()
-	return nil
+
+	var flagset flag.FlagSet
+
+	tree := flagset.Bool("tree", false, "print prev tasks recursively")
+	jsonflag := flagset.Bool("json", false, "print in json format")
+	domain := flagset.String("domain", "", "only list tasks of domain")
+	pkg := flagset.String("package", "", "only list tasks of package")
+
+	if err := flagset.Parse(args); err != nil {
+		return gserrors.Newf(err, "parse list args error")
+	}
+
+	if *tree && *jsonflag {
+		return gserrors.Newf(nil, "--tree and --json can't be used together")
+	}
+
+	format := "text"
+
+	if *tree {
+		format = "tree"
+	}
+
+	if *jsonflag {
+		format = "json"
+	}
+
+	return runner.PrintTasks(runner.Stdout(), gsmake.ListFilter{Domain: *domain, Package: *pkg}, format)
 }
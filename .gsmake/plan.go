@@ -0,0 +1,17 @@
+package tasks
+
+import (
+	"github.com/gsdocker/gserrors"
+	"github.com/gsmake/gsmake"
+)
+
+// TaskPlan .
+func TaskPlan(runner *gsmake.Runner, args ...string) error {
+
+	if len(args) == 0 {
+		runner.I("usage : gsmake plan [domain:][package#]task ...")
+		return gserrors.Newf(nil, "expect task name")
+	}
+
+	return runner.Plan(runner.ParseTargets(args)...)
+}
@@ -1,8 +1,6 @@
 package tasks
 
 import (
-	"os"
-	"os/exec"
 	"path/filepath"
 
 	"github.com/gsdocker/gserrors"
@@ -19,8 +17,6 @@ func TaskSetup(runner *gsmake.Runner, args ...string) error {
 			return gserrors.Newf(nil, "expect setup dir")
 		}
 
-		os.Setenv("GOPATH", runner.RootFS().DomainDir("task"))
-
 		obj, err := filepath.Abs(filepath.Join(args[0], "bin", "gsmake"+fs.ExeSuffix))
 
 		if err != nil {
@@ -29,19 +25,13 @@ func TaskSetup(runner *gsmake.Runner, args ...string) error {
 
 		runner.I("install gsmake to :%s", obj)
 
-		cmd := exec.Command("go", "build", "-o", obj)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
 		target, err := runner.Path("task", "github.com/gsmake/gsmake")
 
 		if err != nil {
 			return err
 		}
 
-		cmd.Dir = filepath.Join(target, "cmd", "gsmake")
-
-		return cmd.Run()
+		return runner.Exec("go", "build", "-o", obj).Domain("task").Dir(filepath.Join(target, "cmd", "gsmake")).Run()
 	}
 
 	return nil
@@ -0,0 +1,141 @@
+package tasks
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gsmake/gsmake"
+	gstesting "github.com/gsmake/gsmake/testing"
+)
+
+func TestTaskCreate(t *testing.T) {
+
+	harness := gstesting.New(t, gsmake.PacakgeAnonymous).Task("create", TaskCreate)
+
+	harness.Package(&gsmake.Package{Name: "github.com/gsmake/archtype"}, map[string]string{
+		".archtype/golang/.gsmake.json": `{"name":"github.com/gsmake/hello"}`,
+		".archtype/golang/main.go":      "package main\n",
+	})
+
+	harness.MustRun("create", "github.com/gsmake/archtype:golang")
+
+	harness.ExpectLog("archtype :golang")
+
+	harness.ExpectFile("golang/main.go")
+
+	harness.MustFail("create", "target dir already exists", "github.com/gsmake/archtype:golang")
+
+	harness.MustFail("create", "invalid arg", "github.com/gsmake/archtype")
+}
+
+func TestTaskCreateInPackage(t *testing.T) {
+
+	harness := gstesting.New(t, "github.com/gsmake/hello").Task("create", TaskCreate)
+
+	harness.MustFail("create", "already in a package dir", "github.com/gsmake/archtype:golang")
+}
+
+func TestTaskCache(t *testing.T) {
+
+	harness := gstesting.New(t, "github.com/gsmake/hello").Task("cache", TaskCache)
+
+	if err := ioutil.WriteFile(filepath.Join(harness.StartDir(), "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	harness.MustRun("cache")
+
+	harness.ExpectLog("cache package")
+
+	// the package is mounted from the start dir after cached
+	path := harness.Mount("golang", "github.com/gsmake/hello")
+
+	harness.ExpectFile(filepath.Join(path, "main.go"))
+}
+
+func TestTaskRedirect(t *testing.T) {
+
+	harness := gstesting.New(t, "github.com/gsmake/hello").Task("redirect", TaskRedirect)
+
+	fork := harness.Package(&gsmake.Package{Name: "github.com/gsmake/fork"}, map[string]string{
+		"fork.go": "package fork\n",
+	})
+
+	harness.Package(&gsmake.Package{
+		Name: "github.com/gsmake/redirect",
+		Properties: map[string]interface{}{
+			"redirect": []map[string]interface{}{
+				{
+					"From": gsmake.Import{Name: "github.com/gsmake/origin"},
+					"To":   gsmake.Import{Name: fork, SCM: "file"},
+				},
+			},
+		},
+	}, nil)
+
+	harness.MustRun("redirect", "github.com/gsmake/redirect")
+
+	harness.ExpectLog("redirect package")
+
+	path := harness.Mount("golang", "github.com/gsmake/origin")
+
+	harness.ExpectFile(filepath.Join(path, "fork.go"))
+}
+
+func TestTaskList(t *testing.T) {
+
+	harness := gstesting.New(t, "github.com/gsmake/hello").Task("list", TaskList)
+
+	harness.MustRun("list", "--json")
+
+	harness.ExpectStdout(`"name": "list"`)
+
+	harness.MustFail("list", "can't be used together", "--tree", "--json")
+}
+
+func TestTaskPlan(t *testing.T) {
+
+	harness := gstesting.New(t, "github.com/gsmake/hello").Task("plan", TaskPlan)
+
+	noop := func(*gsmake.Runner, ...string) error { return nil }
+
+	harness.TaskCmd(&gsmake.TaskCmd{Name: "generate", F: noop, Project: "github.com/gsmake/proto", Scope: "proto"})
+	harness.TaskCmd(&gsmake.TaskCmd{Name: "build", F: noop, Project: "github.com/gsmake/golang", Scope: "golang", Prev: []string{"generate"}})
+	harness.TaskCmd(&gsmake.TaskCmd{Name: "build", F: noop, Project: "github.com/gsmake/hello", Prev: []string{"generate"}})
+
+	harness.MustRun("plan", "golang:build")
+
+	// the groups are ordered by dependency, every contribution shows its package, scope and action
+	harness.ExpectLog(strings.Join([]string{
+		"execution plan of golang:build",
+		"\t1. generate, domain: golang",
+		"\t\t* package:     github.com/gsmake/proto",
+		"\t\t  scope:       PROTO",
+		"\t\t  action:      skip (scope proto is not selected by golang)",
+		"\t2. build, domain: golang",
+		"\t\t* package:     github.com/gsmake/golang",
+		"\t\t  scope:       GOLANG",
+		"\t\t  action:      run",
+		"\t\t* package:     github.com/gsmake/hello",
+		"\t\t  scope:       ALL",
+		"\t\t  action:      run",
+	}, "\n"))
+
+	harness.MustRun("plan", "proto:build")
+
+	harness.ExpectLog(strings.Join([]string{
+		"execution plan of proto:build",
+		"\t1. generate, domain: proto",
+		"\t\t* package:     github.com/gsmake/proto",
+		"\t\t  scope:       PROTO",
+		"\t\t  action:      run",
+		"\t2. build, domain: proto",
+		"\t\t* package:     github.com/gsmake/golang",
+		"\t\t  scope:       GOLANG",
+		"\t\t  action:      skip (scope golang is not selected by proto)",
+	}, "\n"))
+
+	harness.MustFail("plan", "expect task name")
+}
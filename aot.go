@@ -2,16 +2,22 @@ package gsmake
 
 import (
 	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"text/template"
 	"time"
 
 	"go/format"
+	"go/token"
 
 	"github.com/gsdocker/gserrors"
 	"github.com/gsdocker/gslogger"
@@ -19,6 +25,11 @@ import (
 	"github.com/gsmake/gsmake/vfs"
 )
 
+// Errors .
+var (
+	ErrExport = errors.New("export runner error")
+)
+
 // AOTCompiler aot compiler for package
 type AOTCompiler struct {
 	gslogger.Log                     // Mixin gslogger .
@@ -28,6 +39,8 @@ type AOTCompiler struct {
 	rootpath     string              // rootpath
 	target       string              // package vfs path
 	packages     map[string]*Package // loaded packages
+	locker       sync.Mutex          // running process locker
+	process      *os.Process         // running runner process
 }
 
 // Compile .
@@ -41,9 +54,67 @@ func Compile(rootfs vfs.RootFS, imports []Import) (*AOTCompiler, error) {
 		return nil, err
 	}
 
+	tpl, err := newTemplate()
+
+	if err != nil {
+		return nil, err
+	}
+
+	compiler := &AOTCompiler{
+		Log:      log,
+		tpl:      tpl,
+		rootfs:   rootfs,
+		target:   rootfs.TargetPath(),
+		rootpath: rootfs.RootPath(),
+		packages: loader.packages["task"],
+	}
+
+	compiler.binarypath = filepath.Join(compiler.rootfs.TempDir("task"), "runner"+fs.ExeSuffix)
+
+	log.I("compile runner ... ")
+
+	start := time.Now()
+
+	finish := Phase("compile")
+
+	err = compiler.compile(false, compiler.binarypath)
+
+	finish(err)
+
+	log.I("compile runner -- success %s", time.Now().Sub(start))
+
+	if err != nil {
+		return nil, err
+	}
+
+	compiler.writeCompletion(loader)
+
+	return compiler, nil
+}
+
+// newTemplate create the runner code generate template
+func newTemplate() (*template.Template, error) {
+
 	funcs := template.FuncMap{
-		"taskname": func(name string) string {
-			return "Task" + strings.Title(name)
+		"taskname": func(name string, task *Task) string {
+			if task.Func != "" {
+				return task.Func
+			}
+
+			return TaskSymbol(name)
+		},
+		"tasksource": func(pkg *Package) bool {
+			return tasksource(pkg)
+		},
+		"duration": func(duration string) int64 {
+			if duration == "" {
+				return 0
+			}
+
+			// the duration string is checked by loader
+			d, _ := time.ParseDuration(duration)
+
+			return int64(d)
 		},
 		"ospath": func(name string) string {
 			return strings.Replace(name, "\\", "\\\\", -1)
@@ -55,7 +126,7 @@ func Compile(rootfs vfs.RootFS, imports []Import) (*AOTCompiler, error) {
 			buff.WriteString("[]string{")
 
 			for _, name := range names {
-				buff.WriteString(fmt.Sprintf("\"%s\", ", name))
+				buff.WriteString(fmt.Sprintf("%q, ", name))
 			}
 
 			buff.WriteString("}")
@@ -64,39 +135,65 @@ func Compile(rootfs vfs.RootFS, imports []Import) (*AOTCompiler, error) {
 		},
 	}
 
-	tpl, err := template.New("golang").Funcs(funcs).Parse(codegen)
+	return template.New("golang").Funcs(funcs).Parse(codegen)
+}
+
+// Export export relocatable runner and the snapshot of domain userspaces into output dir,
+// the exported runner can run without GSMAKE_HOME, scm tools and golang toolchain
+func (compiler *AOTCompiler) Export(output string) error {
+
+	output, err := filepath.Abs(output)
 
 	if err != nil {
-		return nil, err
+		return gserrors.Newf(err, "get output fullpath error")
 	}
 
-	compiler := &AOTCompiler{
-		Log:      log,
-		tpl:      tpl,
-		rootfs:   rootfs,
-		target:   rootfs.TargetPath(),
-		rootpath: rootfs.RootPath(),
-		packages: loader.packages["task"],
+	if fs.Exists(output) {
+
+		// never remove a dir which isn't an exported runner, e.g. the package itself with -o .
+		if !exported(output) {
+			return gserrors.Newf(ErrExport, "output dir exists and isn't an exported runner\n\t%s", output)
+		}
+
+		if err := os.RemoveAll(output); err != nil {
+			return gserrors.Newf(err, "remove output dir error\n\t%s", output)
+		}
 	}
 
-	compiler.binarypath = filepath.Join(compiler.rootfs.TempDir("task"), "runner"+fs.ExeSuffix)
+	if err := os.MkdirAll(output, 0755); err != nil {
+		return gserrors.Newf(err, "create output dir error\n\t%s", output)
+	}
 
-	log.I("compile runner ... ")
+	compiler.I("export runner ...")
 
 	start := time.Now()
 
-	err = compiler.compile()
+	if err := compiler.compile(true, filepath.Join(output, "runner"+fs.ExeSuffix)); err != nil {
+		return err
+	}
 
-	log.I("compile runner -- success %s", time.Now().Sub(start))
+	if err := vfs.Snapshot(compiler.rootfs, output); err != nil {
+		return gserrors.Newf(err, "snapshot userspace error")
+	}
+
+	compiler.I("export runner -- success %s", time.Now().Sub(start))
+
+	return nil
+}
+
+// exported check if the dir is empty or a previous exported runner which contains snapshot indexer
+func exported(dir string) bool {
+
+	infos, err := ioutil.ReadDir(dir)
 
 	if err != nil {
-		return nil, err
+		return false
 	}
 
-	return compiler, nil
+	return len(infos) == 0 || fs.Exists(filepath.Join(dir, vfs.SnapshotIndexer))
 }
 
-func (compiler *AOTCompiler) compile() error {
+func (compiler *AOTCompiler) compile(relocatable bool, binarypath string) error {
 
 	srcRoot := filepath.Join(compiler.rootfs.DomainDir("task"), "src", "runner")
 
@@ -117,11 +214,13 @@ func (compiler *AOTCompiler) compile() error {
 	}
 
 	var context = struct {
-		RootPath   string
-		TargetPath string
+		RootPath    string
+		TargetPath  string
+		Relocatable bool
 	}{
 		compiler.rootpath,
 		compiler.target,
+		relocatable,
 	}
 
 	err = compiler.gencodes(context, filepath.Join(srcRoot, "main.go"), "main.go")
@@ -132,12 +231,20 @@ func (compiler *AOTCompiler) compile() error {
 
 	i := 0
 
-	for _, pkg := range compiler.packages {
+	for _, pkg := range sortpackages(compiler.packages) {
 
-		if len(pkg.Task) == 0 {
+		if len(pkg.Task) == 0 && len(pkg.Listeners) == 0 {
 			continue
 		}
 
+		if err := checksymbols(pkg); err != nil {
+			return err
+		}
+
+		if err := compiler.digest(pkg); err != nil {
+			return err
+		}
+
 		err := compiler.gencodes(pkg, filepath.Join(srcRoot, fmt.Sprintf("proj_%d.go", i)), "project.go")
 
 		if err != nil {
@@ -147,7 +254,7 @@ func (compiler *AOTCompiler) compile() error {
 		i++
 	}
 
-	err = compiler.genbinary(srcRoot)
+	err = compiler.genbinary(srcRoot, binarypath)
 
 	if err != nil {
 		return gserrors.Newf(err, "generate binary error")
@@ -156,46 +263,160 @@ func (compiler *AOTCompiler) compile() error {
 	return nil
 }
 
-func (compiler *AOTCompiler) genbinary(srcRoot string) error {
+// sortpackages get packages in dependency order, the imported packages come before their importers,
+// the packages without dependency between them are sorted by name
+func sortpackages(packages map[string]*Package) []*Package {
+
+	var names []string
 
-	gopath := os.Getenv("GOPATH")
+	for name := range packages {
+		names = append(names, name)
+	}
 
-	newgopath := compiler.rootfs.DomainDir("task")
+	sort.Strings(names)
 
-	err := os.Setenv("GOPATH", newgopath)
+	var (
+		result  []*Package
+		visited = make(map[string]bool)
+		visit   func(name string)
+	)
 
-	if err != nil {
-		return gserrors.Newf(err, "set new gopath error\n\t%s", newgopath)
+	visit = func(name string) {
+
+		pkg, ok := packages[name]
+
+		if !ok || visited[name] {
+			return
+		}
+
+		visited[name] = true
+
+		for _, ir := range pkg.Import {
+			visit(ir.Name)
+		}
+
+		pkg.Order = len(result)
+
+		result = append(result, pkg)
 	}
 
-	compiler.D("GOPATH:\n/%s", newgopath)
+	for _, name := range names {
+		visit(name)
+	}
 
-	defer func() {
-		os.Setenv("GOPATH", gopath)
-	}()
+	return result
+}
+
+// digest calc the hash of package's .gsmake.json and .gsmake sources, which is part of the task cache key
+func (compiler *AOTCompiler) digest(pkg *Package) error {
 
-	currentDir, err := filepath.Abs("./")
+	_, entry, err := compiler.rootfs.Open(fmt.Sprintf("gsmake://%s?domain=task", pkg.Name))
 
 	if err != nil {
-		return gserrors.Newf(err, "get current dir error")
+		return err
 	}
 
-	err = os.Chdir(srcRoot)
+	pkg.Digest, err = sourcesDigest(entry.Mapping)
+
+	return err
+}
+
+func sourcesDigest(path string) (string, error) {
+
+	files, err := globfiles(path, []string{".gsmake.json", ".gsmake/**"})
 
 	if err != nil {
-		return gserrors.Newf(err, "change current dir error\n\tto:%s", srcRoot)
+		return "", err
 	}
 
-	defer func() {
-		os.Chdir(currentDir)
-	}()
+	hash := sha1.New()
+
+	if err := hashfiles(path, files, hash); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// tasksource check if the package's .gsmake sources are used by the listeners or any task function
+func tasksource(pkg *Package) bool {
+
+	if len(pkg.Listeners) != 0 {
+		return true
+	}
+
+	for _, task := range pkg.Task {
+		if task.Cmd == "" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checksymbols check if more than one task of package bind to the same function
+func checksymbols(pkg *Package) error {
+
+	symbols := make(map[string]string)
+
+	for _, symbol := range pkg.Listeners {
+		if !token.IsIdentifier(symbol) || !token.IsExported(symbol) {
+			return gserrors.Newf(ErrLoad, "%s declare invalid listener function name :%s", pkg.Name, symbol)
+		}
+	}
+
+	for name, task := range pkg.Task {
 
-	cmd := exec.Command("go", "build", "-o", compiler.binarypath)
+		if task.Cmd != "" {
+
+			if task.Func != "" {
+				return gserrors.Newf(ErrLoad, "%s task %s declares both cmd and func", pkg.Name, name)
+			}
+
+			continue
+		}
+
+		symbol := task.Func
+
+		if symbol == "" {
+			symbol = TaskSymbol(name)
+		}
+
+		if !token.IsIdentifier(symbol) || !token.IsExported(symbol) {
+			return gserrors.Newf(ErrLoad, "%s task %s bind to invalid function name :%s", pkg.Name, name, symbol)
+		}
+
+		if other, ok := symbols[symbol]; ok {
+			return gserrors.Newf(ErrLoad, "%s tasks %s and %s bind to the same function :%s\n\tuse func field to bind another function", pkg.Name, other, name, symbol)
+		}
+
+		symbols[symbol] = name
+	}
+
+	return nil
+}
+
+func (compiler *AOTCompiler) genbinary(srcRoot string, binarypath string) error {
+
+	gopath := compiler.rootfs.DomainDir("task")
+
+	compiler.D("GOPATH:\n/%s", gopath)
+
+	cmd := exec.Command("go", "build", "-o", binarypath)
 
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	return cmd.Run()
+	cmd.Dir = srcRoot
+	cmd.Env = append(os.Environ(), "GOPATH="+gopath)
+
+	finish := Phase("go build")
+
+	err := cmd.Run()
+
+	finish(err)
+
+	return err
 }
 
 func (compiler *AOTCompiler) gencodes(context interface{}, path string, tplname string) error {
@@ -233,5 +454,36 @@ func (compiler *AOTCompiler) Run(startdir string, args ...string) error {
 	cmd.Stderr = os.Stderr
 	cmd.Stdin = os.Stdin
 
-	return cmd.Run()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	compiler.locker.Lock()
+	compiler.process = cmd.Process
+	compiler.locker.Unlock()
+
+	defer func() {
+		compiler.locker.Lock()
+		compiler.process = nil
+		compiler.locker.Unlock()
+	}()
+
+	return cmd.Wait()
+}
+
+// Signal forward signal to the running runner process, returns false if the runner is not running
+func (compiler *AOTCompiler) Signal(sig os.Signal) bool {
+
+	compiler.locker.Lock()
+	defer compiler.locker.Unlock()
+
+	if compiler.process == nil {
+		return false
+	}
+
+	if err := compiler.process.Signal(sig); err != nil {
+		compiler.D("forward signal %s to runner error :%s", sig, err)
+	}
+
+	return true
 }
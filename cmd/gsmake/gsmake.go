@@ -6,8 +6,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gsdocker/gserrors"
@@ -23,6 +27,13 @@ gsmake is a build automation software for golang and others
 Usage:
     go [flags] task
 Use "gsmake list" list all task
+Use "gsmake env [-format sh|fish|json] [domain]" print the effective environment of domain
+Use "gsmake 'golang|proto:task'", "gsmake '*:task'" or "gsmake '!test:task'" select task scopes
+Use "gsmake task --prev.arg=value" pass -arg=value to the prerequisite task prev
+Use "gsmake daemon" cache the compiled runner for current package
+Use "gsmake export-runner -o dir" export relocatable runner for CI
+Use "gsmake completion bash|zsh|fish" print shell completion script
+Use "gsmake watch task" rerun task when package files changed
 `
 
 // ImportVars .
@@ -53,6 +64,14 @@ var importVars ImportVars
 var clearflag = flag.Bool("clear", false, "clear usrspace")
 var verbflag = flag.Bool("v", false, "print more debug information")
 var rootflag = flag.String("root", "", "the gsmake's root path")
+var jobsflag = flag.Int("j", 1, "max concurrent running tasks")
+var rerunflag = flag.Bool("rerun-tasks", false, "ignore up-to-date checking")
+var cacheflag = flag.String("cache-url", "", "remote task cache url")
+var dryrunflag = flag.Bool("dry-run", false, "print the execution plan without running tasks")
+var continueflag = flag.Bool("continue", false, "continue running independent tasks after failure")
+var eventsflag = flag.String("events", "", "build events format, only json is supported, the events are streamed to stderr without -events-file")
+var eventsfileflag = flag.String("events-file", "", "append json build events into file")
+var traceflag = flag.String("trace", "", "write chrome trace events into file")
 
 var versionflag = flag.Bool("version", false, "print more debug information")
 
@@ -124,6 +143,191 @@ func readconfig(log gslogger.Log) (string, string) {
 	return homepath, packagedir
 }
 
+// signaler forward signal to the running runner, returns false if the runner is not running
+type signaler interface {
+	Signal(sig os.Signal) bool
+}
+
+var (
+	runningLocker sync.Mutex // running runner locker
+	running       signaler   // the compiler or daemon client whose runner is running
+)
+
+// handlesignals forward SIGINT/SIGTERM to the running runner which cancels tasks gracefully,
+// if the runner is not running, clear the anonymous package and exit
+func handlesignals(log gslogger.Log, rootfs vfs.RootFS, anonymous bool) {
+
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		for sig := range signals {
+
+			runningLocker.Lock()
+			runner := running
+			runningLocker.Unlock()
+
+			if runner != nil && runner.Signal(sig) {
+				log.W("forward signal %s to runner", sig)
+				continue
+			}
+
+			log.W("interrupted by signal %s", sig)
+
+			if anonymous {
+				clearanonymous(rootfs)
+			}
+
+			gslogger.Join()
+			os.Exit(1)
+		}
+	}()
+}
+
+// clearanonymous clear the userspace and remove the temporary package dir of anonymous package
+func clearanonymous(rootfs vfs.RootFS) {
+
+	rootfs.Clear()
+
+	os.RemoveAll(rootfs.TargetPath())
+}
+
+func rundaemon(log gslogger.Log, rootfs vfs.RootFS) {
+
+	daemon, err := gsmake.NewDaemon(rootfs, importVars.imports)
+
+	if err != nil {
+		gserrors.Panic(err)
+	}
+
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		log.I("stop daemon ...")
+		daemon.Close()
+	}()
+
+	if err := daemon.Serve(); err != nil {
+		gserrors.Panic(err)
+	}
+
+	log.I("stop daemon -- success")
+}
+
+// runwatch stop watching by the first SIGINT/SIGTERM, the second one clears the anonymous package and exits
+// if the running runner doesn't stop in time
+func runwatch(log gslogger.Log, rootfs vfs.RootFS, startdir string, args []string, anonymous bool) {
+
+	if len(args) == 0 || flag.NArg() < 2 {
+		gserrors.Panicf(nil, "expect watch task name")
+	}
+
+	watcher := gsmake.NewWatcher(rootfs, importVars.imports, startdir, args)
+
+	signals := make(chan os.Signal, 1)
+
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		<-signals
+		log.I("stop watching ...")
+		watcher.Close()
+
+		sig := <-signals
+
+		log.W("interrupted by signal %s", sig)
+
+		if anonymous {
+			clearanonymous(rootfs)
+		}
+
+		gslogger.Join()
+		os.Exit(1)
+	}()
+
+	if err := watcher.Watch(); err != nil {
+		gserrors.Panic(err)
+	}
+}
+
+func exportrunner(rootfs vfs.RootFS, args []string) {
+
+	var flagset flag.FlagSet
+
+	output := flagset.String("o", "gsmake-runner", "the exported runner output dir")
+
+	if err := flagset.Parse(args); err != nil {
+		gserrors.Panic(err)
+	}
+
+	compiler, err := gsmake.Compile(rootfs, importVars.imports)
+
+	if err != nil {
+		gserrors.Panic(err)
+	}
+
+	if err := compiler.Export(*output); err != nil {
+		gserrors.Panic(err)
+	}
+}
+
+// subcommands completed besides tasks
+var subcommands = []string{"daemon", "export-runner", "completion", "watch"}
+
+func completion(log gslogger.Log, shell string) {
+
+	script, err := gsmake.CompletionScript(shell)
+
+	if err != nil {
+		log.E("%s", err)
+		gslogger.Join()
+		os.Exit(1)
+	}
+
+	fmt.Print(script)
+}
+
+// complete print completion candidates from the index written by last compiling,
+// it never compiles runner or creates anonymous package, so it's fast enough for shell completion
+func complete(current string, words []string) {
+
+	var cliflags []string
+
+	flag.VisitAll(func(f *flag.Flag) {
+		cliflags = append(cliflags, "-"+f.Name)
+	})
+
+	index := &gsmake.CompletionIndex{Tasks: make(map[string][]string)}
+
+	homepath := os.Getenv(gsmake.EnvHome)
+
+	if *rootflag != "" {
+		homepath = *rootflag
+	}
+
+	if fullpath, err := filepath.Abs("./"); err == nil && homepath != "" && fs.Exists(".gsmake.json") {
+		index = gsmake.LoadCompletion(homepath, fullpath)
+	}
+
+	candidates := index.Complete(words, current, cliflags)
+
+	if len(words) == 0 && !strings.HasPrefix(current, "-") {
+		for _, name := range subcommands {
+			if strings.HasPrefix(name, current) {
+				candidates = append(candidates, name)
+			}
+		}
+	}
+
+	for _, candidate := range candidates {
+		fmt.Println(candidate)
+	}
+}
+
 func main() {
 
 	currentdir := fs.Current()
@@ -143,8 +347,116 @@ func main() {
 		gslogger.NewFlags(gslogger.ASSERT | gslogger.ERROR | gslogger.WARN | gslogger.INFO)
 	}
 
+	switch flag.Arg(0) {
+	case "completion":
+		completion(log, flag.Arg(1))
+		return
+	case "__complete":
+		var words []string
+
+		if flag.NArg() > 2 {
+			words = flag.Args()[2:]
+		}
+
+		complete(flag.Arg(1), words)
+		return
+	}
+
 	rootpath, targetpath := readconfig(log)
 
+	args := []string{}
+
+	if *verbflag {
+		args = append(args, "-v")
+	}
+
+	if *jobsflag > 1 {
+		args = append(args, "-j", strconv.Itoa(*jobsflag))
+	}
+
+	if *rerunflag {
+		args = append(args, "-rerun-tasks")
+	}
+
+	if *cacheflag != "" {
+		args = append(args, "-cache-url", *cacheflag)
+	}
+
+	if *dryrunflag {
+		args = append(args, "-dry-run")
+	}
+
+	if *continueflag {
+		args = append(args, "-continue")
+	}
+
+	if *eventsflag != "" {
+		args = append(args, "-events", *eventsflag)
+	}
+
+	if *eventsfileflag != "" {
+
+		eventsfile, err := filepath.Abs(*eventsfileflag)
+
+		if err != nil {
+			log.E("get events file full path error\n%s", err)
+			gslogger.Join()
+			os.Exit(1)
+		}
+
+		*eventsfileflag = eventsfile
+
+		args = append(args, "-events-file", eventsfile)
+	}
+
+	if *traceflag != "" {
+
+		tracefile, err := filepath.Abs(*traceflag)
+
+		if err != nil {
+			log.E("get trace file full path error\n%s", err)
+			gslogger.Join()
+			os.Exit(1)
+		}
+
+		// the cli and runner append spans into the trace file of this run
+		if err := os.RemoveAll(tracefile); err != nil {
+			log.E("remove trace file error\n%s", err)
+			gslogger.Join()
+			os.Exit(1)
+		}
+
+		*traceflag = tracefile
+
+		args = append(args, "-trace", tracefile)
+	}
+
+	args = append(args, flag.Args()...)
+
+	events, err := gsmake.OpenEvents(*eventsflag, *eventsfileflag, "cli")
+
+	if err != nil {
+		log.E("%s", err)
+		gslogger.Join()
+		os.Exit(1)
+	}
+
+	if events != nil {
+		gsmake.UseEvents(events)
+	}
+
+	trace, err := gsmake.OpenTrace(*traceflag, "cli")
+
+	if err != nil {
+		log.E("%s", err)
+		gslogger.Join()
+		os.Exit(1)
+	}
+
+	if trace != nil {
+		gsmake.UseEvents(trace)
+	}
+
 	rootfs, err := vfs.New(rootpath, targetpath)
 
 	if err != nil {
@@ -153,9 +465,11 @@ func main() {
 		os.Exit(1)
 	}
 
-	if strings.HasPrefix(targetpath, os.TempDir()) {
+	anonymous := strings.HasPrefix(targetpath, os.TempDir())
+
+	if anonymous {
 		defer func() {
-			rootfs.Clear()
+			clearanonymous(rootfs)
 
 			if e := recover(); e != nil {
 				log.E("%s", e)
@@ -183,6 +497,53 @@ func main() {
 		}
 	}
 
+	if flag.Arg(0) == "daemon" {
+		rundaemon(log, rootfs)
+		return
+	}
+
+	if flag.Arg(0) == "watch" {
+		// strip the watch subcommand from runner args
+		runwatch(log, rootfs, currentdir, append(args[:len(args)-flag.NArg()], flag.Args()[1:]...), anonymous)
+		return
+	}
+
+	handlesignals(log, rootfs, anonymous)
+
+	if flag.Arg(0) == "export-runner" {
+		exportrunner(rootfs, flag.Args()[1:])
+		return
+	}
+
+	if !*clearflag {
+
+		if client, err := gsmake.DialDaemon(rootpath, targetpath); err == nil {
+
+			log.D("exec gsmake runner through daemon ...")
+
+			runningLocker.Lock()
+			running = client
+			runningLocker.Unlock()
+
+			err := client.Run(currentdir, importVars.imports, os.Environ(), os.Stdin, os.Stdout, os.Stderr, args...)
+
+			runningLocker.Lock()
+			running = nil
+			runningLocker.Unlock()
+
+			if !gsmake.ImportsMismatch(err) {
+
+				if err != nil {
+					gserrors.Panic(err)
+				}
+
+				return
+			}
+
+			log.D("daemon imports mismatch, build gsmake runner locally ...")
+		}
+	}
+
 	log.I("build gsmake runner ...")
 
 	startime := time.Now()
@@ -195,19 +556,21 @@ func main() {
 
 	log.I("build gsmake runner -- success %v", time.Now().Sub(startime))
 
-	args := []string{}
+	log.I("exec gsmake runner ...")
 
-	if *verbflag {
-		args = append(args, "-v")
-	}
+	startime = time.Now()
 
-	args = append(args, flag.Args()...)
+	runningLocker.Lock()
+	running = compiler
+	runningLocker.Unlock()
 
-	log.I("exec gsmake runner ...")
+	finish := gsmake.Phase("exec runner")
 
-	startime = time.Now()
+	err = compiler.Run(currentdir, args...)
+
+	finish(err)
 
-	if err := compiler.Run(currentdir, args...); err != nil {
+	if err != nil {
 		gserrors.Panic(err)
 	}
 
@@ -1,18 +1,61 @@
 package gsmake
 
+import (
+	"bytes"
+	"unicode"
+)
+
+// TaskSymbol map task name to the default golang task function name,
+// the task name is split by non-identifier characters and every part is title-cased,
+// e.g: go:build -> TaskGoBuild, docker-push -> TaskDockerPush
+func TaskSymbol(name string) string {
+
+	var buff bytes.Buffer
+
+	buff.WriteString("Task")
+
+	upper := true
+
+	for _, c := range name {
+
+		if !unicode.IsLetter(c) && !unicode.IsDigit(c) && c != '_' {
+			upper = true
+			continue
+		}
+
+		if upper {
+			c = unicode.ToUpper(c)
+			upper = false
+		}
+
+		buff.WriteRune(c)
+	}
+
+	return buff.String()
+}
+
 var codegen = `
 {{define "main.go"}}
 // generate builder for {{.TargetPath}}
 package main
 import "os"
+import "os/signal"
+import "syscall"
 import "fmt"
 import "flag"
-import "strings"
 import "github.com/gsdocker/gslogger"
 import "github.com/gsmake/gsmake"
 
 var verbflag = flag.Bool("v", false, "print more debug information")
-var context = gsmake.NewRunner("{{ospath .RootPath}}","{{ospath .TargetPath}}")
+var jobsflag = flag.Int("j", 1, "max concurrent running tasks")
+var rerunflag = flag.Bool("rerun-tasks", false, "ignore up-to-date checking")
+var dryrunflag = flag.Bool("dry-run", false, "print the execution plan without running tasks")
+var continueflag = flag.Bool("continue", false, "continue running independent tasks after failure")
+var eventsflag = flag.String("events", "", "build events format, only json is supported, the events are streamed to stderr without -events-file")
+var eventsfileflag = flag.String("events-file", "", "append json build events into file")
+var traceflag = flag.String("trace", "", "append chrome trace events into file")
+var cacheflag = flag.String("cache-url", os.Getenv(gsmake.EnvCacheURL), "remote task cache url")
+{{if .Relocatable}}var context = gsmake.NewRelocatableRunner(){{else}}var context = gsmake.NewRunner("{{ospath .RootPath}}","{{ospath .TargetPath}}"){{end}}
 func main(){
     flag.Parse()
     gslogger.Console(gsmake.Logfmt, gsmake.LogTimefmt)
@@ -23,13 +66,54 @@ func main(){
     if !*verbflag {
 		gslogger.NewFlags(gslogger.ASSERT | gslogger.ERROR | gslogger.WARN | gslogger.INFO)
 	}
+    events, err := gsmake.OpenEvents(*eventsflag, *eventsfileflag, "runner")
+    if err != nil {
+        context.E("%s",err)
+        gslogger.Join()
+        os.Exit(1)
+    }
+    if events != nil {
+        gsmake.UseEvents(events)
+    }
+    trace, err := gsmake.OpenTrace(*traceflag, "runner")
+    if err != nil {
+        context.E("%s",err)
+        gslogger.Join()
+        os.Exit(1)
+    }
+    if trace != nil {
+        gsmake.UseEvents(trace)
+    }
+    signals := make(chan os.Signal, 1)
+    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+    go func() {
+        for range signals {
+            context.Cancel()
+        }
+    }()
     if err := context.Start(); err != nil {
         context.E("%s",err)
         gslogger.Join()
         os.Exit(1)
     }
-    context.D("exec task [%s] with args : %s",flag.Arg(0),strings.Join(flag.Args()[1:]," "))
-    if err := context.Run(flag.Arg(0),flag.Args()[1:]...); err != nil {
+    context.Jobs(*jobsflag)
+    context.RerunTasks(*rerunflag)
+    context.ContinueOnError(*continueflag)
+    if *cacheflag != "" {
+        context.UseCache(gsmake.NewHTTPCache(*cacheflag))
+    }
+    targets := context.ParseTargets(flag.Args())
+    if *dryrunflag {
+        if err := context.Plan(targets...); err != nil {
+            context.E("%s",err)
+            gslogger.Join()
+            os.Exit(1)
+        }
+        gslogger.Join()
+        return
+    }
+    context.D("exec targets : %v",targets)
+    if err := context.RunTargets(targets...); err != nil {
         context.E("%s",err)
         gslogger.Join()
         os.Exit(1)
@@ -39,17 +123,39 @@ func main(){
 {{end}}
 {{define "project.go"}}
 package main
-import "github.com/gsmake/gsmake"
-import task "{{.Name}}/.gsmake"
+{{if .Task}}import "github.com/gsmake/gsmake"{{end}}
+{{if tasksource .}}import task "{{.Name}}/.gsmake"{{end}}
 func init(){
+    {{range .Listeners}}
+    context.Listen(task.{{.}}(context))
+    {{end}}
     {{range $key, $value := .Task}}
     context.Task(&gsmake.TaskCmd{
-        Name : "{{$key}}",
-        Description : "{{$value.Description}}",
-        F : task.{{taskname $key}},
+        Name : {{printf "%q" $key}},
+        Description : {{printf "%q" $value.Description}},
+        {{if $value.Cmd}}Cmd : {{printf "%q" $value.Cmd}},{{else}}F : task.{{taskname $key $value}},{{end}}
         Prev : {{prev $value.Prev}},
-        Project : "{{$value.Package}}",
-        Scope : "{{$value.Domain}}",
+        Project : {{printf "%q" $value.Package}},
+        Scope : {{printf "%q" $value.Domain}},
+        Exclusive : {{$value.Exclusive}},
+        Inputs : {{printf "%#v" $value.Inputs}},
+        Outputs : {{printf "%#v" $value.Outputs}},
+        Version : {{printf "%q" $.Version}},
+        Digest : {{printf "%q" $.Digest}},
+        VarArgs : {{$value.VarArgs}},
+        Timeout : {{duration $value.Timeout}},
+        Always : {{$value.Always}},
+        FinalizedBy : {{printf "%#v" $value.FinalizedBy}},
+        Retries : {{$value.Retries}},
+        RetryDelay : {{duration $value.RetryDelay}},
+        RetryOn : {{printf "%#v" $value.RetryOn}},
+        Order : {{$.Order}},
+        Before : {{printf "%#v" $value.Before}},
+        After : {{printf "%#v" $value.After}},
+        Args : {{printf "%#v" $value.Args}},
+        Env : {{printf "%#v" $value.Env}},
+        PackageEnv : {{printf "%#v" $.Env}},
+        DomainEnv : {{printf "%#v" $.DomainEnv}},
     })
     {{end}}
 }
@@ -0,0 +1,220 @@
+package gsmake
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gsmake/gsmake/vfs"
+)
+
+func TestTaskSymbol(t *testing.T) {
+
+	symbols := map[string]string{
+		"list":          "TaskList",
+		"go:build":      "TaskGoBuild",
+		"docker-push":   "TaskDockerPush",
+		"release.notes": "TaskReleaseNotes",
+		"gen_proto":     "TaskGen_proto",
+	}
+
+	for name, expect := range symbols {
+		if symbol := TaskSymbol(name); symbol != expect {
+			t.Fatalf("task %s expect symbol %s, got %s", name, expect, symbol)
+		}
+	}
+}
+
+func TestExportOutput(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	compiler := &AOTCompiler{}
+
+	// the package dir isn't an exported runner, it's never removed
+	if err := compiler.Export(dir); err == nil {
+		t.Fatal("expect refuse to overwrite package dir")
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "main.go")); err != nil {
+		t.Fatalf("expect package dir kept :%s", err)
+	}
+
+	empty := filepath.Join(dir, "empty")
+
+	if err := os.Mkdir(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if !exported(empty) {
+		t.Fatal("expect empty dir can be exported into")
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, vfs.SnapshotIndexer), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !exported(dir) {
+		t.Fatal("expect previous exported runner can be overwritten")
+	}
+}
+
+func TestShellTaskCodegen(t *testing.T) {
+
+	tpl, err := newTemplate()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	compiler := &AOTCompiler{tpl: tpl}
+
+	path := filepath.Join(dir, "proj_0.go")
+
+	pkg := &Package{
+		Name: "github.com/gsmake/test",
+		Task: map[string]*Task{"lint": {Cmd: `golint "./..."`}},
+		Env:  map[string]string{"CGO_ENABLED": "0"},
+	}
+
+	if err := checksymbols(pkg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := compiler.gencodes(pkg, path, "project.go"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the package without task functions and listeners may have no .gsmake sources
+	if strings.Contains(string(content), "/.gsmake\"") {
+		t.Fatalf("expect no task package import\n%s", content)
+	}
+
+	for _, expect := range []string{`"golint \"./...\""`, `"CGO_ENABLED": "0"`} {
+		if !strings.Contains(string(content), expect) {
+			t.Fatalf("expect generated code contains :%s\n%s", expect, content)
+		}
+	}
+
+	pkg.Task["lint"].Func = "TaskLint"
+
+	if err := checksymbols(pkg); err == nil {
+		t.Fatal("expect cmd and func conflict error")
+	}
+}
+
+func TestTaskNameCodegen(t *testing.T) {
+
+	tpl, err := newTemplate()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	compiler := &AOTCompiler{tpl: tpl}
+
+	path := filepath.Join(dir, "proj_0.go")
+
+	name := `say "hi" \n`
+
+	pkg := &Package{
+		Name: "github.com/gsmake/test",
+		Task: map[string]*Task{
+			name: {Func: "TaskSay", Description: `print "hi" \`, Prev: []string{`c:\build`}, Package: "github.com/gsmake/test"},
+		},
+	}
+
+	if err := checksymbols(pkg); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := compiler.gencodes(pkg, path, "project.go"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the quotes and backslashes in task name and description are escaped as go string literals
+	file, err := parser.ParseFile(token.NewFileSet(), path, nil, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values := make(map[string][]string)
+
+	ast.Inspect(file, func(node ast.Node) bool {
+
+		kv, ok := node.(*ast.KeyValueExpr)
+
+		if !ok {
+			return true
+		}
+
+		key, ok := kv.Key.(*ast.Ident)
+
+		if !ok {
+			return true
+		}
+
+		ast.Inspect(kv.Value, func(node ast.Node) bool {
+
+			if lit, ok := node.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+
+				value, err := strconv.Unquote(lit.Value)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				values[key.Name] = append(values[key.Name], value)
+			}
+
+			return true
+		})
+
+		return false
+	})
+
+	for key, expect := range map[string]string{"Name": name, "Description": `print "hi" \`, "Prev": `c:\build`} {
+		if len(values[key]) != 1 || values[key][0] != expect {
+			t.Fatalf("expect %s %s, got %v", key, expect, values[key])
+		}
+	}
+}
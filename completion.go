@@ -0,0 +1,219 @@
+package gsmake
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gsdocker/gserrors"
+)
+
+// CompletionIndex the cached query of compiled runner for shell completion
+type CompletionIndex struct {
+	Tasks   map[string][]string // registered task names and their declared flags
+	Domains []string            // loaded domains
+}
+
+// CompletionFile get the completion index path for target package
+func CompletionFile(rootpath, targetpath string) string {
+	return statefile(rootpath, targetpath, ".completion.json")
+}
+
+// newCompletionIndex create completion index from loaded packages
+func newCompletionIndex(loader *Loader) *CompletionIndex {
+
+	index := &CompletionIndex{
+		Tasks: make(map[string][]string),
+	}
+
+	for domain := range loader.packages {
+		index.Domains = append(index.Domains, domain)
+	}
+
+	sort.Strings(index.Domains)
+
+	for _, pkg := range loader.packages["task"] {
+		for name, task := range pkg.Task {
+			index.Tasks[name] = append(index.Tasks[name], task.Flags...)
+		}
+	}
+
+	return index
+}
+
+func (index *CompletionIndex) save(path string) error {
+
+	content, err := json.Marshal(index)
+
+	if err != nil {
+		return gserrors.Newf(err, "marshal completion index error")
+	}
+
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		return gserrors.Newf(err, "write completion index error\n\t%s", path)
+	}
+
+	return nil
+}
+
+// LoadCompletion load the completion index written by last compiling, returns empty index if the runner is never compiled
+func LoadCompletion(rootpath, targetpath string) *CompletionIndex {
+
+	index := &CompletionIndex{
+		Tasks: make(map[string][]string),
+	}
+
+	content, err := ioutil.ReadFile(CompletionFile(rootpath, targetpath))
+
+	if err != nil {
+		return index
+	}
+
+	if err := json.Unmarshal(content, index); err != nil || index.Tasks == nil {
+		return &CompletionIndex{Tasks: make(map[string][]string)}
+	}
+
+	return index
+}
+
+// task get the task name of word, the word may have domain prefix
+func (index *CompletionIndex) task(word string) (string, bool) {
+
+	if _, ok := index.Tasks[word]; ok {
+		return word, true
+	}
+
+	if i := strings.Index(word, ":"); i != -1 {
+		if _, ok := index.Tasks[word[i+1:]]; ok {
+			return word[i+1:], true
+		}
+	}
+
+	return "", false
+}
+
+// Complete get the sorted completion candidates of current word, words are the preceding command line words
+func (index *CompletionIndex) Complete(words []string, current string, cliflags []string) []string {
+
+	var candidates []string
+
+	if strings.HasPrefix(current, "-") {
+
+		lasttask := ""
+
+		for _, word := range words {
+			if name, ok := index.task(word); ok {
+				lasttask = name
+			}
+		}
+
+		if lasttask == "" {
+			candidates = cliflags
+		} else {
+			candidates = index.Tasks[lasttask]
+		}
+
+	} else {
+
+		domains := make(map[string]bool)
+
+		for _, domain := range index.Domains {
+			domains[domain] = true
+		}
+
+		prefix := ""
+
+		if i := strings.Index(current, ":"); i != -1 && domains[current[:i]] {
+			prefix = current[:i+1]
+		}
+
+		for name := range index.Tasks {
+			candidates = append(candidates, prefix+name)
+		}
+
+		if prefix == "" {
+			for _, domain := range index.Domains {
+				candidates = append(candidates, domain+":")
+			}
+		}
+	}
+
+	var result []string
+
+	seen := make(map[string]bool)
+
+	for _, candidate := range candidates {
+		if strings.HasPrefix(candidate, current) && !seen[candidate] {
+			seen[candidate] = true
+			result = append(result, candidate)
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// CompletionScript get shell completion script, the script calls back "gsmake __complete current words..."
+func CompletionScript(shell string) (string, error) {
+
+	switch shell {
+	case "bash":
+		return bashCompletion, nil
+	case "zsh":
+		return zshCompletion, nil
+	case "fish":
+		return fishCompletion, nil
+	}
+
+	return "", gserrors.Newf(ErrTask, "unsupport shell :%s, expect bash, zsh or fish", shell)
+}
+
+var bashCompletion = `# gsmake bash completion, usage: source <(gsmake completion bash)
+_gsmake() {
+    local cur words cword
+    if declare -F _get_comp_words_by_ref >/dev/null; then
+        _get_comp_words_by_ref -n : cur words cword
+    else
+        cur="${COMP_WORDS[COMP_CWORD]}"
+        words=("${COMP_WORDS[@]}")
+        cword=$COMP_CWORD
+    fi
+    COMPREPLY=($(gsmake __complete "$cur" "${words[@]:1:cword-1}" 2>/dev/null))
+    if declare -F __ltrim_colon_completions >/dev/null; then
+        __ltrim_colon_completions "$cur"
+    fi
+}
+complete -o default -F _gsmake gsmake
+`
+
+var zshCompletion = `#compdef gsmake
+# gsmake zsh completion, usage: source <(gsmake completion zsh)
+_gsmake() {
+    local -a candidates
+    candidates=(${(f)"$(gsmake __complete "${words[CURRENT]}" "${(@)words[2,CURRENT-1]}" 2>/dev/null)"})
+    compadd -a candidates
+}
+compdef _gsmake gsmake
+`
+
+var fishCompletion = `# gsmake fish completion, usage: gsmake completion fish | source
+function __gsmake_complete
+    set -l tokens (commandline -opc)
+    gsmake __complete (commandline -ct) $tokens[2..-1] 2>/dev/null
+end
+complete -c gsmake -f -a '(__gsmake_complete)'
+`
+
+// writeCompletion refresh the completion index after compiling, the error is only logged
+func (compiler *AOTCompiler) writeCompletion(loader *Loader) {
+
+	path := CompletionFile(compiler.rootpath, compiler.target)
+
+	if err := newCompletionIndex(loader).save(path); err != nil {
+		compiler.W("%s", err)
+		os.Remove(path)
+	}
+}
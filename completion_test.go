@@ -0,0 +1,40 @@
+package gsmake
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompletionComplete(t *testing.T) {
+
+	index := &CompletionIndex{
+		Tasks: map[string][]string{
+			"list":     {"--tree", "--json"},
+			"redirect": {"-v", "-p"},
+			"run":      nil,
+		},
+		Domains: []string{"golang", "task"},
+	}
+
+	cliflags := []string{"-v", "-root", "-j"}
+
+	for _, test := range []struct {
+		words   []string
+		current string
+		expect  []string
+	}{
+		{nil, "", []string{"golang:", "list", "redirect", "run", "task:"}},
+		{nil, "r", []string{"redirect", "run"}},
+		{nil, "golang:r", []string{"golang:redirect", "golang:run"}},
+		{nil, "unknown:r", nil},
+		{nil, "-", []string{"-j", "-root", "-v"}},
+		{[]string{"-v", "list"}, "--", []string{"--json", "--tree"}},
+		{[]string{"golang:redirect"}, "-", []string{"-p", "-v"}},
+		{[]string{"list", "redirect"}, "-p", []string{"-p"}},
+		{[]string{"list"}, "", []string{"golang:", "list", "redirect", "run", "task:"}},
+	} {
+		if result := index.Complete(test.words, test.current, cliflags); !reflect.DeepEqual(result, test.expect) {
+			t.Fatalf("complete %v %s :expect %v\n\tgot :%v", test.words, test.current, test.expect, result)
+		}
+	}
+}
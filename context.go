@@ -0,0 +1,108 @@
+package gsmake
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/gsdocker/gserrors"
+)
+
+// Errors .
+var (
+	ErrTimeout = errors.New("task timeout")
+	ErrCancel  = errors.New("task canceled")
+)
+
+// Context get the context of current task, it's done when the task timeout or the run is canceled.
+// long running task should watch it, the commands started by Exec are killed when it is done.
+// The task function can't be stopped by force: if it doesn't return within a second after the context done,
+// the task fails and the function is abandoned while still running, together with the goroutines and
+// the child processes not started by Exec
+func (runner *Runner) Context() context.Context {
+	return runner.ctx
+}
+
+// Cancel cancel the running tasks gracefully, the tasks not started will never run
+func (runner *Runner) Cancel() {
+
+	runner.cancelOnce.Do(func() {
+
+		runner.W("cancel running tasks ...")
+
+		runner.cancel()
+	})
+}
+
+// canceled check if the run is canceled
+func (runner *Runner) canceled() bool {
+	return runner.ctx.Err() != nil
+}
+
+// call call task function with task's timeout,
+// the task function is abandoned if it doesn't return within a second after task context done
+func (runner *Runner) call(task *TaskCmd, args []string) error {
+
+	if err := runner.ctx.Err(); err != nil {
+		return gserrors.Newf(ErrCancel, "task %s:%s canceled", task.Project, task.Name)
+	}
+
+	ctx := runner.ctx
+
+	if task.Timeout > 0 {
+
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, task.Timeout)
+
+		defer cancel()
+	}
+
+	taskrunner := *runner
+
+	taskrunner.ctx = ctx
+
+	result := make(chan error, 1)
+
+	go func() {
+
+		defer func() {
+			if e := recover(); e != nil {
+				if err, ok := e.(error); ok {
+					result <- gserrors.Newf(err, "task %s:%s panic", task.Project, task.Name)
+				} else {
+					result <- gserrors.Newf(ErrTask, "task %s:%s panic :%v", task.Project, task.Name, e)
+				}
+			}
+		}()
+
+		if task.F == nil {
+			result <- taskrunner.shell(task, args...)
+			return
+		}
+
+		result <- task.F(&taskrunner, args...)
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-ctx.Done():
+	}
+
+	// give the task function a chance to return the context error by itself
+	select {
+	case err := <-result:
+		if err != nil {
+			return err
+		}
+	case <-time.After(time.Second):
+		runner.W("task %s:%s doesn't return after context done, abandon it", task.Project, task.Name)
+	}
+
+	if ctx.Err() == context.DeadlineExceeded && runner.ctx.Err() == nil {
+		return gserrors.Newf(ErrTimeout, "task %s:%s timeout after %s", task.Project, task.Name, task.Timeout)
+	}
+
+	return gserrors.Newf(ErrCancel, "task %s:%s canceled", task.Project, task.Name)
+}
@@ -0,0 +1,64 @@
+package gsmake
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTaskTimeout(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	runner.Task(&TaskCmd{Name: "watch", Timeout: 50 * time.Millisecond, F: func(runner *Runner, args ...string) error {
+		<-runner.Context().Done()
+		return runner.Context().Err()
+	}})
+
+	// the task ignores its context, it's abandoned after the grace period
+	runner.Task(&TaskCmd{Name: "hang", Timeout: 50 * time.Millisecond, F: func(runner *Runner, args ...string) error {
+		time.Sleep(3 * time.Second)
+		return nil
+	}})
+
+	if err := runner.Run("watch"); err == nil || !strings.Contains(err.Error(), "deadline") {
+		t.Fatalf("expect task deadline error, got %v", err)
+	}
+
+	start := time.Now()
+
+	if err := runner.Run("hang"); err == nil || !strings.Contains(err.Error(), "timeout after") {
+		t.Fatalf("expect task timeout error, got %v", err)
+	}
+
+	if elapsed := time.Now().Sub(start); elapsed > 2*time.Second {
+		t.Fatalf("expect hanging task abandoned, run took %s", elapsed)
+	}
+}
+
+func TestCancelBetweenGroups(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	ran := false
+
+	runner.Task(&TaskCmd{Name: "a", F: func(runner *Runner, args ...string) error {
+		runner.Cancel()
+		return nil
+	}})
+
+	runner.Task(&TaskCmd{Name: "b", Prev: []string{"a"}, F: func(runner *Runner, args ...string) error {
+		ran = true
+		return nil
+	}})
+
+	err := runner.Run("b")
+
+	if err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Fatalf("expect canceled error, got %v", err)
+	}
+
+	if ran {
+		t.Fatal("expect task not started after cancel")
+	}
+}
@@ -0,0 +1,570 @@
+package gsmake
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/gsdocker/gserrors"
+	"github.com/gsdocker/gslogger"
+	"github.com/gsdocker/gsos/fs"
+	"github.com/gsmake/gsmake/vfs"
+)
+
+// Errors .
+var (
+	ErrDaemon        = errors.New("daemon error")
+	ErrDaemonImports = errors.New("daemon imports mismatch")
+)
+
+// daemon poll interval for manifest and task source changes
+const daemonPollInterval = time.Second
+
+type daemonRequest struct {
+	Dir     string   // runner start dir
+	Args    []string // runner args
+	Imports []Import // client extra imports, must be the same as the daemon's
+	Env     []string // client environment, the runner is started with it
+}
+
+// daemonInput the client stdin content and cancel notify, sent after the request
+type daemonInput struct {
+	Stdin  []byte `json:",omitempty"` // stdin content
+	EOF    bool   `json:",omitempty"` // stdin closed flag
+	Cancel bool   `json:",omitempty"` // the client is interrupted, cancel the runner gracefully
+}
+
+type daemonMessage struct {
+	Stdout string `json:",omitempty"` // runner stdout content
+	Stderr string `json:",omitempty"` // runner stderr content
+	Exit   bool   `json:",omitempty"` // runner exit flag
+	Error  string `json:",omitempty"` // runner exit error
+	Reject bool   `json:",omitempty"` // the request is rejected because of imports mismatch
+}
+
+// daemonStream stream runner output back to daemon client
+type daemonStream struct {
+	sync.Mutex               // mutex
+	encoder    *json.Encoder // json encoder
+}
+
+func (stream *daemonStream) send(msg *daemonMessage) error {
+	stream.Lock()
+	defer stream.Unlock()
+
+	return stream.encoder.Encode(msg)
+}
+
+type daemonWriter struct {
+	stream *daemonStream // message stream
+	stderr bool          // stderr flag
+}
+
+func (writer *daemonWriter) Write(p []byte) (int, error) {
+
+	msg := &daemonMessage{}
+
+	if writer.stderr {
+		msg.Stderr = string(p)
+	} else {
+		msg.Stdout = string(p)
+	}
+
+	if err := writer.stream.send(msg); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// DaemonAddr get the daemon unix socket path for target package
+func DaemonAddr(rootpath, targetpath string) string {
+	return statefile(rootpath, targetpath, ".sock")
+}
+
+// statefile get the per target package state file path under system temp dir
+func statefile(rootpath, targetpath, suffix string) string {
+
+	if fullpath, err := filepath.Abs(rootpath); err == nil {
+		rootpath = fullpath
+	}
+
+	if fullpath, err := filepath.Abs(targetpath); err == nil {
+		targetpath = fullpath
+	}
+
+	hash := sha1.Sum([]byte(rootpath + "\n" + targetpath))
+
+	return filepath.Join(os.TempDir(), fmt.Sprintf("gsmake-%s%s", hex.EncodeToString(hash[:8]), suffix))
+}
+
+// Daemon cache the compiled runner for target package, which saves the runner compiling of each request,
+// the runner is rebuilt if the manifests or task sources changed. Each request still execs the runner,
+// which loads the package graph itself
+type Daemon struct {
+	gslogger.Log               // Mixin Log APIs
+	sync.RWMutex               // compiler rebuild locker
+	rootfs       vfs.RootFS    // vfs
+	imports      []Import      // extra imports
+	compiler     *AOTCompiler  // current compiler
+	stamp        string        // watched files stamp
+	addr         string        // unix socket path
+	listener     net.Listener  // unix socket listener
+	closed       chan struct{} // close notify chan
+	closeOnce    sync.Once     // close once
+}
+
+// NewDaemon create new daemon and compile the runner
+func NewDaemon(rootfs vfs.RootFS, imports []Import) (*Daemon, error) {
+
+	daemon := &Daemon{
+		Log:     gslogger.Get("daemon"),
+		rootfs:  rootfs,
+		imports: imports,
+		addr:    DaemonAddr(rootfs.RootPath(), rootfs.TargetPath()),
+		closed:  make(chan struct{}),
+	}
+
+	if err := daemon.rebuild(); err != nil {
+		return nil, err
+	}
+
+	return daemon, nil
+}
+
+// Addr get daemon listen address
+func (daemon *Daemon) Addr() string {
+	return daemon.addr
+}
+
+func (daemon *Daemon) rebuild() error {
+
+	daemon.Lock()
+	defer daemon.Unlock()
+
+	compiler, err := Compile(daemon.rootfs, daemon.imports)
+
+	if err != nil {
+		return err
+	}
+
+	daemon.compiler = compiler
+
+	daemon.stamp, err = daemon.calcstamp()
+
+	return err
+}
+
+// calcstamp calc the modify stamp of all task domain manifests and .gsmake sources
+func (daemon *Daemon) calcstamp() (string, error) {
+
+	var files []string
+
+	paths := []string{daemon.rootfs.TargetPath()}
+
+	for name := range daemon.compiler.packages {
+
+		_, target, err := daemon.rootfs.Open(fmt.Sprintf("gsmake://%s?domain=task", name))
+
+		if err != nil {
+			continue
+		}
+
+		paths = append(paths, target.Mapping)
+	}
+
+	for _, path := range paths {
+
+		files = append(files, filepath.Join(path, ".gsmake.json"))
+
+		sources, err := filepath.Glob(filepath.Join(path, ".gsmake", "*.go"))
+
+		if err != nil {
+			return "", gserrors.Newf(err, "glob .gsmake sources error\n\t%s", path)
+		}
+
+		files = append(files, sources...)
+	}
+
+	hash := sha1.New()
+
+	for _, file := range files {
+
+		info, err := os.Stat(file)
+
+		if err != nil {
+			continue
+		}
+
+		fmt.Fprintf(hash, "%s %d %d\n", file, info.Size(), info.ModTime().UnixNano())
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func (daemon *Daemon) watch() {
+
+	ticker := time.NewTicker(daemonPollInterval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-daemon.closed:
+			return
+		case <-ticker.C:
+		}
+
+		daemon.RLock()
+		stamp, err := daemon.calcstamp()
+		changed := stamp != daemon.stamp
+		daemon.RUnlock()
+
+		if err != nil {
+			daemon.E("check source changes error\n%s", err)
+			continue
+		}
+
+		if !changed {
+			continue
+		}
+
+		daemon.I("source changed, rebuild runner ...")
+
+		startime := time.Now()
+
+		if err := daemon.rebuild(); err != nil {
+			daemon.E("rebuild runner error\n%s", err)
+			continue
+		}
+
+		daemon.I("source changed, rebuild runner -- success %s", time.Now().Sub(startime))
+	}
+}
+
+// Serve accept task requests over unix socket until daemon closed
+func (daemon *Daemon) Serve() error {
+
+	if fs.Exists(daemon.addr) {
+
+		if conn, err := net.Dial("unix", daemon.addr); err == nil {
+			conn.Close()
+			return gserrors.Newf(ErrDaemon, "daemon already running\n\t%s", daemon.addr)
+		}
+
+		if err := os.Remove(daemon.addr); err != nil {
+			return gserrors.Newf(err, "remove stale daemon socket error\n\t%s", daemon.addr)
+		}
+	}
+
+	listener, err := net.Listen("unix", daemon.addr)
+
+	if err != nil {
+		return gserrors.Newf(err, "listen daemon socket error\n\t%s", daemon.addr)
+	}
+
+	daemon.listener = listener
+
+	daemon.I("daemon listen on :%s", daemon.addr)
+
+	go daemon.watch()
+
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			select {
+			case <-daemon.closed:
+				return nil
+			default:
+				return gserrors.Newf(err, "daemon accept error")
+			}
+		}
+
+		go daemon.handle(conn)
+	}
+}
+
+// Close close daemon and remove the unix socket
+func (daemon *Daemon) Close() error {
+
+	var err error
+
+	daemon.closeOnce.Do(func() {
+
+		close(daemon.closed)
+
+		if daemon.listener != nil {
+			err = daemon.listener.Close()
+		}
+	})
+
+	return err
+}
+
+func (daemon *Daemon) handle(conn net.Conn) {
+
+	defer conn.Close()
+
+	decoder := json.NewDecoder(conn)
+
+	var request daemonRequest
+
+	if err := decoder.Decode(&request); err != nil {
+		daemon.E("decode daemon request error\n%s", err)
+		return
+	}
+
+	stream := &daemonStream{encoder: json.NewEncoder(conn)}
+
+	// the runner is compiled with the daemon's imports, let the client compile its own runner
+	if !sameImports(request.Imports, daemon.imports) {
+
+		if err := stream.send(&daemonMessage{Exit: true, Reject: true, Error: "the imports differ from the daemon's"}); err != nil {
+			daemon.E("send daemon response error\n%s", err)
+		}
+
+		return
+	}
+
+	daemon.D("exec runner in %s with args : %v", request.Dir, request.Args)
+
+	// the started runner process is not affected by rebuilding, so the lock only guards the binary path
+	daemon.RLock()
+	binarypath := daemon.compiler.binarypath
+	daemon.RUnlock()
+
+	cmd := exec.Command(binarypath, request.Args...)
+
+	cmd.Dir = request.Dir
+	cmd.Stdout = &daemonWriter{stream: stream}
+	cmd.Stderr = &daemonWriter{stream: stream, stderr: true}
+
+	if len(request.Env) > 0 {
+		cmd.Env = request.Env
+	}
+
+	stdin, err := cmd.StdinPipe()
+
+	if err == nil {
+		err = cmd.Start()
+	}
+
+	if err == nil {
+
+		go forwardInput(decoder, stdin, cmd.Process)
+
+		err = cmd.Wait()
+	}
+
+	msg := &daemonMessage{Exit: true}
+
+	if err != nil {
+		msg.Error = err.Error()
+	}
+
+	if err := stream.send(msg); err != nil {
+		daemon.E("send daemon response error\n%s", err)
+	}
+}
+
+// forwardInput write the client stdin content into runner stdin until the client closed stdin, and interrupt
+// the runner if the client is canceled or the connection is lost before the runner exits
+func forwardInput(decoder *json.Decoder, stdin io.WriteCloser, process *os.Process) {
+
+	defer stdin.Close()
+
+	for {
+		var input daemonInput
+
+		if err := decoder.Decode(&input); err != nil {
+			// the process has exited if the connection is closed by daemon, the signal is ignored then
+			process.Signal(os.Interrupt)
+			return
+		}
+
+		if len(input.Stdin) > 0 {
+			stdin.Write(input.Stdin)
+		}
+
+		if input.EOF {
+			stdin.Close()
+		}
+
+		if input.Cancel {
+			process.Signal(os.Interrupt)
+		}
+	}
+}
+
+func sameImports(lhs, rhs []Import) bool {
+
+	if len(lhs) == 0 && len(rhs) == 0 {
+		return true
+	}
+
+	return reflect.DeepEqual(lhs, rhs)
+}
+
+// ImportsMismatch check if the daemon rejected the request because of the different imports
+func ImportsMismatch(err error) bool {
+	for {
+		if gserror, ok := err.(gserrors.GSError); ok {
+			err = gserror.Origin()
+			continue
+		}
+
+		break
+	}
+
+	return err == ErrDaemonImports
+}
+
+// DaemonClient the client of a running daemon
+type DaemonClient struct {
+	sync.Mutex               // encoder locker
+	addr       string        // daemon unix socket path
+	encoder    *json.Encoder // the running request encoder
+}
+
+// DialDaemon check if the daemon for target package is running
+func DialDaemon(rootpath, targetpath string) (*DaemonClient, error) {
+
+	addr := DaemonAddr(rootpath, targetpath)
+
+	if !fs.Exists(addr) {
+		return nil, gserrors.Newf(ErrDaemon, "daemon not running")
+	}
+
+	conn, err := net.Dial("unix", addr)
+
+	if err != nil {
+		return nil, gserrors.Newf(err, "dial daemon error\n\t%s", addr)
+	}
+
+	conn.Close()
+
+	return &DaemonClient{addr: addr}, nil
+}
+
+// Run run task through daemon with the env, the stdin is forwarded to the runner and the runner output
+// is streamed to stdout and stderr. The imports must be the same as the daemon's, otherwise the request
+// is rejected with ErrDaemonImports. The stdin reading goroutine is not stopped if the runner exits while
+// it's blocked
+func (client *DaemonClient) Run(startdir string, imports []Import, env []string, stdin io.Reader, stdout, stderr io.Writer, args ...string) error {
+
+	conn, err := net.Dial("unix", client.addr)
+
+	if err != nil {
+		return gserrors.Newf(err, "dial daemon error\n\t%s", client.addr)
+	}
+
+	defer conn.Close()
+
+	encoder := json.NewEncoder(conn)
+
+	if err := encoder.Encode(&daemonRequest{Dir: startdir, Args: args, Imports: imports, Env: env}); err != nil {
+		return gserrors.Newf(err, "send daemon request error")
+	}
+
+	client.Lock()
+	client.encoder = encoder
+	client.Unlock()
+
+	defer func() {
+		client.Lock()
+		client.encoder = nil
+		client.Unlock()
+	}()
+
+	go client.sendStdin(encoder, stdin)
+
+	decoder := json.NewDecoder(conn)
+
+	for {
+		var msg daemonMessage
+
+		if err := decoder.Decode(&msg); err != nil {
+			return gserrors.Newf(err, "read daemon response error")
+		}
+
+		if msg.Stdout != "" {
+			io.WriteString(stdout, msg.Stdout)
+		}
+
+		if msg.Stderr != "" {
+			io.WriteString(stderr, msg.Stderr)
+		}
+
+		if msg.Exit {
+
+			if msg.Reject {
+				return gserrors.Newf(ErrDaemonImports, "%s", msg.Error)
+			}
+
+			if msg.Error != "" {
+				return gserrors.Newf(ErrDaemon, "%s", msg.Error)
+			}
+
+			return nil
+		}
+	}
+}
+
+// Signal ask the daemon to cancel the running runner gracefully, returns false if no request is running
+func (client *DaemonClient) Signal(sig os.Signal) bool {
+
+	client.Lock()
+	defer client.Unlock()
+
+	if client.encoder == nil {
+		return false
+	}
+
+	client.encoder.Encode(&daemonInput{Cancel: true})
+
+	return true
+}
+
+// sendStdin send stdin content to daemon until stdin closed
+func (client *DaemonClient) sendStdin(encoder *json.Encoder, stdin io.Reader) {
+
+	send := func(input *daemonInput) error {
+		client.Lock()
+		defer client.Unlock()
+
+		return encoder.Encode(input)
+	}
+
+	if stdin == nil {
+		send(&daemonInput{EOF: true})
+		return
+	}
+
+	buff := make([]byte, 4096)
+
+	for {
+		n, err := stdin.Read(buff)
+
+		if n > 0 {
+			if send(&daemonInput{Stdin: buff[:n]}) != nil {
+				return
+			}
+		}
+
+		if err != nil {
+			send(&daemonInput{EOF: true})
+			return
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package gsmake
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gsdocker/gslogger"
+)
+
+func TestDaemonHandle(t *testing.T) {
+
+	cat, err := exec.LookPath("cat")
+
+	if err != nil {
+		t.Skip("cat not found")
+	}
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	addr := filepath.Join(dir, "daemon.sock")
+
+	listener, err := net.Listen("unix", addr)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	daemon := &Daemon{
+		Log:      gslogger.Get("daemon"),
+		imports:  []Import{{Name: "github.com/gsmake/golang"}},
+		compiler: &AOTCompiler{binarypath: cat},
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go daemon.handle(conn)
+		}
+	}()
+
+	client := &DaemonClient{addr: addr}
+
+	var stdout, stderr bytes.Buffer
+
+	// the stdin is forwarded to the runner, cat echoes it
+	if err := client.Run(dir, daemon.imports, nil, strings.NewReader("hello daemon"), &stdout, &stderr); err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout.String() != "hello daemon" {
+		t.Fatalf("expect stdin forwarded, got stdout :%s", stdout.String())
+	}
+
+	err = client.Run(dir, nil, nil, nil, &stdout, &stderr)
+
+	if !ImportsMismatch(err) {
+		t.Fatalf("expect imports mismatch, got %v", err)
+	}
+}
+
+func TestDaemonEnvAndCancel(t *testing.T) {
+
+	sh, err := exec.LookPath("sh")
+
+	if err != nil {
+		t.Skip("sh not found")
+	}
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	addr := filepath.Join(dir, "daemon.sock")
+
+	listener, err := net.Listen("unix", addr)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	daemon := &Daemon{
+		Log:      gslogger.Get("daemon"),
+		compiler: &AOTCompiler{binarypath: sh},
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				return
+			}
+
+			go daemon.handle(conn)
+		}
+	}()
+
+	client := &DaemonClient{addr: addr}
+
+	var stdout, stderr bytes.Buffer
+
+	// the runner is started with the client env
+	if err := client.Run(dir, nil, []string{"GSMAKE_TEST=client"}, nil, &stdout, &stderr, "-c", "echo $GSMAKE_TEST"); err != nil {
+		t.Fatal(err)
+	}
+
+	if stdout.String() != "client\n" {
+		t.Fatalf("expect client env forwarded, got stdout :%s", stdout.String())
+	}
+
+	if client.Signal(os.Interrupt) {
+		t.Fatal("expect no running request")
+	}
+
+	exit := make(chan error, 1)
+
+	go func() {
+		exit <- client.Run(dir, nil, nil, nil, &stdout, &stderr, "-c", "while :; do sleep 0.05; done")
+	}()
+
+	for !client.Signal(os.Interrupt) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case err := <-exit:
+		if err == nil {
+			t.Fatal("expect canceled runner error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expect runner canceled by client")
+	}
+}
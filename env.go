@@ -0,0 +1,94 @@
+package gsmake
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/gsdocker/gserrors"
+	"github.com/gsmake/gsmake/property"
+)
+
+// Environ get the effective environment variables declared by gsmake for domain and current task,
+// the layers are GOPATH of domain, the package env and domain env of the package which defined current task,
+// the root package env and domain env, and task env, the latter wins. Only the commands started by Exec and
+// the shell command tasks get them, the processes started by task functions themselves inherit the runner
+// process environment unchanged
+func (runner *Runner) Environ(domain string) map[string]string {
+
+	env := make(map[string]string)
+
+	if domain != "" && runner.rootfs != nil {
+		env["GOPATH"] = runner.rootfs.DomainDir(domain)
+	}
+
+	var layers []map[string]string
+
+	if runner.current != nil {
+		layers = append(layers, runner.current.PackageEnv, runner.current.DomainEnv[domain])
+	}
+
+	var properties property.Properties
+
+	if runner.currentpkg != nil {
+
+		properties = runner.currentpkg.Properties
+
+		layers = append(layers, runner.currentpkg.Env, runner.currentpkg.DomainEnv[domain])
+	}
+
+	if runner.current != nil {
+		layers = append(layers, runner.current.Env)
+	}
+
+	for _, layer := range layers {
+		for key, value := range layer {
+			env[key] = properties.Expand(value)
+		}
+	}
+
+	return env
+}
+
+// PrintEnv print environment variables in sh, fish or json format
+func PrintEnv(writer io.Writer, env map[string]string, format string) error {
+
+	var keys []string
+
+	for key := range env {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	var stream bytes.Buffer
+
+	switch format {
+	case "sh":
+		for _, key := range keys {
+			stream.WriteString(fmt.Sprintf("export %s='%s'\n", key, strings.Replace(env[key], "'", `'\''`, -1)))
+		}
+	case "fish":
+		for _, key := range keys {
+			stream.WriteString(fmt.Sprintf("set -gx %s '%s'\n", key, strings.Replace(strings.Replace(env[key], `\`, `\\`, -1), "'", `\'`, -1)))
+		}
+	case "json":
+		content, err := json.MarshalIndent(env, "", "  ")
+
+		if err != nil {
+			return gserrors.Newf(err, "marshal env error")
+		}
+
+		stream.Write(content)
+		stream.WriteString("\n")
+	default:
+		return gserrors.Newf(ErrTask, "unsupport env format :%s", format)
+	}
+
+	_, err := writer.Write(stream.Bytes())
+
+	return err
+}
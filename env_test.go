@@ -0,0 +1,102 @@
+package gsmake
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/gsmake/gsmake/property"
+)
+
+func TestEnviron(t *testing.T) {
+
+	runner := newTestRunner(t)
+
+	gopath := runner.rootfs.DomainDir("golang")
+
+	runner.currentpkg = &Package{
+		Name:       "github.com/gsmake/test",
+		Properties: property.Properties{"version": "v1.0.0"},
+		Env:        map[string]string{"GOPATH": "pkg", "MODE": "pkg", "TAG": "pkg", "VERSION": "${version}"},
+		DomainEnv: map[string]map[string]string{
+			"golang": {"MODE": "golang", "TAG": "golang"},
+		},
+	}
+
+	task := &TaskCmd{Name: "build", Project: "github.com/gsmake/test", Env: map[string]string{"TAG": "task-${version}"}}
+
+	for _, test := range []struct {
+		name   string
+		runner *Runner
+		domain string
+		expect map[string]string
+	}{
+		{
+			name:   "package env overrides gopath",
+			runner: runner,
+			domain: "golang",
+			expect: map[string]string{"GOPATH": "pkg", "MODE": "golang", "TAG": "golang", "VERSION": "v1.0.0"},
+		},
+		{
+			name:   "task env overrides domain env",
+			runner: runner.fork(task),
+			domain: "golang",
+			expect: map[string]string{"GOPATH": "pkg", "MODE": "golang", "TAG": "task-v1.0.0", "VERSION": "v1.0.0"},
+		},
+		{
+			name: "root package env overrides the env of package which defined task",
+			runner: runner.fork(&TaskCmd{
+				Name:       "lint",
+				Project:    "github.com/gsmake/golang",
+				PackageEnv: map[string]string{"LINT": "plugin", "MODE": "plugin"},
+				DomainEnv:  map[string]map[string]string{"golang": {"CGO": "0", "TAG": "plugin"}},
+			}),
+			domain: "golang",
+			expect: map[string]string{"CGO": "0", "GOPATH": "pkg", "LINT": "plugin", "MODE": "golang", "TAG": "golang", "VERSION": "v1.0.0"},
+		},
+		{
+			name:   "domain env of other domain is ignored",
+			runner: runner.fork(task),
+			domain: "proto",
+			expect: map[string]string{"GOPATH": "pkg", "MODE": "pkg", "TAG": "task-v1.0.0", "VERSION": "v1.0.0"},
+		},
+	} {
+		if env := test.runner.Environ(test.domain); !reflect.DeepEqual(env, test.expect) {
+			t.Fatalf("%s :expect %v\n\tgot :%v", test.name, test.expect, env)
+		}
+	}
+
+	delete(runner.currentpkg.Env, "GOPATH")
+
+	if env := runner.Environ("golang"); env["GOPATH"] != gopath {
+		t.Fatalf("expect domain GOPATH %s, got %s", gopath, env["GOPATH"])
+	}
+}
+
+func TestPrintEnv(t *testing.T) {
+
+	env := map[string]string{"B": `it's \ok`, "A": "1"}
+
+	for _, test := range []struct {
+		format string
+		expect string
+	}{
+		{"sh", "export A='1'\nexport B='it'\\''s \\ok'\n"},
+		{"fish", "set -gx A '1'\nset -gx B 'it\\'s \\\\ok'\n"},
+		{"json", "{\n  \"A\": \"1\",\n  \"B\": \"it's \\\\ok\"\n}\n"},
+	} {
+		var buff bytes.Buffer
+
+		if err := PrintEnv(&buff, env, test.format); err != nil {
+			t.Fatal(err)
+		}
+
+		if buff.String() != test.expect {
+			t.Fatalf("format %s :expect\n%s\n\tgot :\n%s", test.format, test.expect, buff.String())
+		}
+	}
+
+	if err := PrintEnv(&bytes.Buffer{}, env, "cmd"); err == nil {
+		t.Fatal("expect unsupported format error")
+	}
+}
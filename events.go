@@ -0,0 +1,186 @@
+package gsmake
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gsdocker/gserrors"
+	"github.com/gsmake/gsmake/vfs"
+)
+
+// Errors .
+var (
+	ErrEvents = errors.New("build events error")
+)
+
+// build event types
+const (
+	EventPhaseStart  = "phase.start"
+	EventPhaseFinish = "phase.finish"
+	EventPhaseFail   = "phase.fail"
+	EventMount       = "mount"
+	EventTaskStart   = "task.start"
+	EventTaskSkip    = "task.skip"
+	EventTaskRetry   = "task.retry"
+	EventTaskFinish  = "task.finish"
+	EventTaskFail    = "task.fail"
+)
+
+// Event the build event
+type Event struct {
+	Time    time.Time     `json:"time"`              // event time
+	Process string        `json:"process"`           // the process emits event, cli or runner
+	Type    string        `json:"type"`              // event type
+	Name    string        `json:"name,omitempty"`    // phase name, task name or mount target
+	Package string        `json:"package,omitempty"` // the package defined task
+	Domain  string        `json:"domain,omitempty"`  // selected domain
+	Elapsed time.Duration `json:"elapsed,omitempty"` // elapsed nanoseconds of finished phase or task
+	Message string        `json:"message,omitempty"` // event message, e.g: skip reason
+	Error   string        `json:"error,omitempty"`   // error message
+	Span    uint64        `json:"span,omitempty"`    // phase id, pairs the phase start and finish events
+}
+
+// EventSink the build events consumer
+type EventSink interface {
+	// Emit handle build event, it may be called concurrently
+	Emit(event *Event)
+}
+
+// EventWriter write newline-delimited json events
+type EventWriter struct {
+	sync.Mutex               // writer locker
+	process    string        // process name
+	encoder    *json.Encoder // json encoder
+}
+
+// NewEventWriter create json event writer for process
+func NewEventWriter(writer io.Writer, process string) *EventWriter {
+	return &EventWriter{
+		process: process,
+		encoder: json.NewEncoder(writer),
+	}
+}
+
+// OpenEvents open event writer by command line flags, the events file is opened in append mode,
+// so the cli and runner processes can share it; the events are streamed to stderr which is inherited
+// by the runner if only the format is given; returns nil if no events are required.
+// The events are never written to stdout, which is shared with the log and task output
+func OpenEvents(format string, file string, process string) (*EventWriter, error) {
+
+	if format != "" && format != "json" {
+		return nil, gserrors.Newf(ErrEvents, "unsupport events format :%s", format)
+	}
+
+	if file == "" {
+
+		if format != "" {
+			return NewEventWriter(os.Stderr, process), nil
+		}
+
+		return nil, nil
+	}
+
+	writer, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return nil, gserrors.Newf(err, "open events file error\n\t%s", file)
+	}
+
+	return NewEventWriter(writer, process), nil
+}
+
+// Emit implement EventSink
+func (writer *EventWriter) Emit(event *Event) {
+	writer.Lock()
+	defer writer.Unlock()
+
+	if event.Process == "" {
+		event.Process = writer.process
+	}
+
+	writer.encoder.Encode(event)
+}
+
+var (
+	sinksLocker sync.RWMutex // sinks locker
+	sinks       []EventSink  // registered event sinks
+	spans       uint64       // last phase id
+)
+
+// UseEvents register build events sink of current process
+func UseEvents(sink EventSink) {
+	sinksLocker.Lock()
+	defer sinksLocker.Unlock()
+
+	sinks = append(sinks, sink)
+}
+
+func emit(event Event) {
+	sinksLocker.RLock()
+	defer sinksLocker.RUnlock()
+
+	if len(sinks) == 0 {
+		return
+	}
+
+	event.Time = time.Now()
+
+	for _, sink := range sinks {
+		e := event
+		sink.Emit(&e)
+	}
+}
+
+func init() {
+	vfs.Trace(phase)
+}
+
+// Phase emit phase start event, and returns the function emits phase finish or fail event
+func Phase(name string) func(err error) {
+	return phase(name, "")
+}
+
+func phase(name string, message string) func(err error) {
+
+	start := time.Now()
+
+	span := atomic.AddUint64(&spans, 1)
+
+	emit(Event{Type: EventPhaseStart, Name: name, Message: message, Span: span})
+
+	return func(err error) {
+
+		event := Event{Type: EventPhaseFinish, Name: name, Elapsed: time.Now().Sub(start), Message: message, Span: span}
+
+		if err != nil {
+			event.Type = EventPhaseFail
+			event.Error = err.Error()
+		}
+
+		emit(event)
+	}
+}
+
+// emitTask emit task event
+func emitTask(eventType string, task *TaskCmd, domain string, elapsed time.Duration, message string, err error) {
+
+	event := Event{
+		Type:    eventType,
+		Name:    task.Name,
+		Package: task.Project,
+		Domain:  domain,
+		Elapsed: elapsed,
+		Message: message,
+	}
+
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	emit(event)
+}
@@ -0,0 +1,90 @@
+package gsmake
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpenEvents(t *testing.T) {
+
+	if _, err := OpenEvents("xml", "", "cli"); err == nil {
+		t.Fatal("expect unsupported events format")
+	}
+
+	if writer, err := OpenEvents("", "", "cli"); err != nil || writer != nil {
+		t.Fatalf("expect no events writer, got %v %v", writer, err)
+	}
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "events.json")
+
+	writer, err := OpenEvents("json", file, "cli")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writer.Emit(&Event{Type: EventPhaseStart, Name: "load"})
+
+	content, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var event Event
+
+	if err := json.Unmarshal(content, &event); err != nil || event.Process != "cli" || event.Name != "load" {
+		t.Fatalf("unexpected event :%s %v", content, err)
+	}
+}
+
+func TestOpenEventsStream(t *testing.T) {
+
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reader.Close()
+
+	stderr := os.Stderr
+
+	os.Stderr = writer
+
+	events, err := OpenEvents("json", "", "runner")
+
+	os.Stderr = stderr
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the events are streamed to stderr without events file
+	events.Emit(&Event{Type: EventTaskStart, Name: "build"})
+
+	writer.Close()
+
+	content, err := ioutil.ReadAll(reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var event Event
+
+	if err := json.Unmarshal(content, &event); err != nil || event.Process != "runner" || event.Name != "build" {
+		t.Fatalf("unexpected event :%s %v", content, err)
+	}
+}
@@ -0,0 +1,234 @@
+package gsmake
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/gsdocker/gserrors"
+)
+
+// Errors .
+var (
+	ErrExec = errors.New("exec command error")
+)
+
+// the max captured stderr size included in exec error
+const stderrTail = 4096
+
+// Command external command builder, created by Runner.Exec
+type Command struct {
+	runner  *Runner           // runner
+	name    string            // command name
+	args    []string          // command args
+	domain  string            // the domain whose dir is used as GOPATH
+	dir     string            // working dir
+	env     map[string]string // extra environment variables
+	stdin   io.Reader         // stdin
+	tee     bool              // write captured stdout into task log too
+	timeout time.Duration     // command timeout
+}
+
+// Exec create external command builder, the command runs in processing package dir
+// with GOPATH set to the dir of invoked domain, and it's killed when the task context done
+func (runner *Runner) Exec(name string, args ...string) *Command {
+	return &Command{
+		runner: runner,
+		name:   name,
+		args:   args,
+		domain: runner.domain,
+		dir:    runner.targetpath,
+		env:    make(map[string]string),
+	}
+}
+
+// Domain set the domain whose dir is used as GOPATH
+func (cmd *Command) Domain(domain string) *Command {
+	cmd.domain = domain
+	return cmd
+}
+
+// Dir set the working dir, the relative path is based on processing package dir
+func (cmd *Command) Dir(dir string) *Command {
+
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(cmd.runner.targetpath, dir)
+	}
+
+	cmd.dir = dir
+
+	return cmd
+}
+
+// Env set extra environment variable
+func (cmd *Command) Env(key, value string) *Command {
+	cmd.env[key] = value
+	return cmd
+}
+
+// Stdin set the stdin of command
+func (cmd *Command) Stdin(reader io.Reader) *Command {
+	cmd.stdin = reader
+	return cmd
+}
+
+// Tee write the captured output into task log too
+func (cmd *Command) Tee() *Command {
+	cmd.tee = true
+	return cmd
+}
+
+// Timeout set command timeout, the command is killed after timeout
+func (cmd *Command) Timeout(timeout time.Duration) *Command {
+	cmd.timeout = timeout
+	return cmd
+}
+
+func (cmd *Command) String() string {
+	return strings.TrimSpace(cmd.name + " " + strings.Join(cmd.args, " "))
+}
+
+// Run run command, the output is written into task log
+func (cmd *Command) Run() error {
+	return cmd.run(cmd.runner.Stdout())
+}
+
+// Output run command and get the captured stdout
+func (cmd *Command) Output() (string, error) {
+
+	var stdout bytes.Buffer
+
+	var writer io.Writer = &stdout
+
+	if cmd.tee {
+		writer = io.MultiWriter(&stdout, cmd.runner.Stdout())
+	}
+
+	err := cmd.run(writer)
+
+	return stdout.String(), err
+}
+
+// environ get command environment variables
+func (cmd *Command) environ() []string {
+
+	env := cmd.runner.Environ(cmd.domain)
+
+	for key, value := range cmd.env {
+		env[key] = value
+	}
+
+	var environ []string
+
+	for _, kv := range os.Environ() {
+
+		if index := strings.Index(kv, "="); index != -1 {
+			if _, ok := env[kv[:index]]; ok {
+				continue
+			}
+		}
+
+		environ = append(environ, kv)
+	}
+
+	for key, value := range env {
+		environ = append(environ, key+"="+value)
+	}
+
+	return environ
+}
+
+func (cmd *Command) run(stdout io.Writer) error {
+
+	runner := cmd.runner
+
+	if runner.dryrun {
+		runner.I("dry-run exec %s\n\tdir :%s", cmd, cmd.dir)
+		return nil
+	}
+
+	ctx := runner.ctx
+
+	if cmd.timeout > 0 {
+
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, cmd.timeout)
+
+		defer cancel()
+	}
+
+	stderr := &tailWriter{max: stderrTail}
+
+	command := exec.CommandContext(ctx, cmd.name, cmd.args...)
+
+	command.Dir = cmd.dir
+	command.Env = cmd.environ()
+	command.Stdin = cmd.stdin
+	command.Stdout = stdout
+	command.Stderr = io.MultiWriter(runner.Stderr(), stderr)
+
+	runner.D("exec %s\n\tdir :%s", cmd, cmd.dir)
+
+	err := command.Run()
+
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() == context.DeadlineExceeded && runner.ctx.Err() == nil {
+		return gserrors.Newf(ErrTimeout, "exec %s timeout after %s", cmd, cmd.timeout)
+	}
+
+	if ctx.Err() != nil {
+		return gserrors.Newf(ErrCancel, "exec %s canceled", cmd)
+	}
+
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		return gserrors.Newf(ErrExec, "exec %s error, exit code %d\n%s", cmd, exitErr.ExitCode(), stderr)
+	}
+
+	return gserrors.Newf(err, "exec %s error", cmd)
+}
+
+// shell run the shell command of task by Exec, the args are passed as positional parameters
+func (runner *Runner) shell(task *TaskCmd, args ...string) error {
+
+	if task.Cmd == "" {
+		return gserrors.Newf(ErrTask, "task %s:%s has neither function nor cmd", task.Project, task.Name)
+	}
+
+	if runtime.GOOS == "windows" {
+		return runner.Exec("cmd", append([]string{"/C", task.Cmd}, args...)...).Run()
+	}
+
+	return runner.Exec("sh", append([]string{"-c", task.Cmd, task.Name}, args...)...).Run()
+}
+
+// tailWriter keep the last max bytes written
+type tailWriter struct {
+	max  int    // max keep bytes
+	buff []byte // kept bytes
+}
+
+func (writer *tailWriter) Write(p []byte) (int, error) {
+
+	writer.buff = append(writer.buff, p...)
+
+	if len(writer.buff) > writer.max {
+		writer.buff = writer.buff[len(writer.buff)-writer.max:]
+	}
+
+	return len(p), nil
+}
+
+func (writer *tailWriter) String() string {
+	return string(bytes.TrimSpace(writer.buff))
+}
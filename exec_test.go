@@ -0,0 +1,93 @@
+package gsmake
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestExecDryRun(t *testing.T) {
+
+	if _, err := exec.LookPath("touch"); err != nil {
+		t.Skip("touch not found")
+	}
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "touched")
+
+	runner := NewRunner("", "")
+
+	runner.Task(&TaskCmd{Name: "touch", F: func(runner *Runner, args ...string) error {
+		return runner.Exec("touch", path).Run()
+	}})
+
+	runner.DryRun(true)
+
+	if err := runner.Run("touch"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expect command not spawned under dry-run, stat %s :%v", path, err)
+	}
+
+	runner.DryRun(false)
+
+	if err := runner.Run("touch"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expect command spawned, stat %s :%v", path, err)
+	}
+}
+
+func TestShellTask(t *testing.T) {
+
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "out")
+
+	runner := NewRunner("", "")
+
+	// the shell command gets the declared env and the task args as positional parameters
+	runner.Task(&TaskCmd{
+		Name:       "echo",
+		Cmd:        `echo "$MODE $TAG $1" > ` + path,
+		PackageEnv: map[string]string{"MODE": "plugin"},
+		Env:        map[string]string{"TAG": "task"},
+	})
+
+	if err := runner.RunTargets(Target{Name: "echo", Args: []string{"arg"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(content) != "plugin task arg\n" {
+		t.Fatalf("unexpected shell task output :%s", content)
+	}
+}
@@ -0,0 +1,305 @@
+package gsmake
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gsdocker/gserrors"
+	"github.com/gsdocker/gsos/fs"
+)
+
+// TaskInputs task declared inputs
+type TaskInputs struct {
+	Files      []string // input file globs, relative to the processing package path
+	Properties []string // input property names of the processing package
+}
+
+// fingerprint the task up-to-date check record
+type fingerprint struct {
+	Inputs  string     // inputs hash
+	Outputs string     // outputs hash
+	Values  taskValues `json:",omitempty"` // the values stored by task
+}
+
+// globRegexp convert glob pattern to regexp, '**' matches any directories
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+
+	var buff strings.Builder
+
+	buff.WriteString("^")
+
+	pattern = filepath.ToSlash(pattern)
+
+	for i := 0; i < len(pattern); i++ {
+
+		c := pattern[i]
+
+		switch c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				buff.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				buff.WriteString(".*")
+				i++
+			} else {
+				buff.WriteString("[^/]*")
+			}
+		case '?':
+			buff.WriteString("[^/]")
+		default:
+			buff.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	buff.WriteString("$")
+
+	return regexp.Compile(buff.String())
+}
+
+// globfiles get the sorted slash separated relative paths of files under root which match any glob patterns
+func globfiles(root string, patterns []string) ([]string, error) {
+
+	var matchers []*regexp.Regexp
+
+	for _, pattern := range patterns {
+
+		matcher, err := globRegexp(pattern)
+
+		if err != nil {
+			return nil, gserrors.Newf(err, "invalid glob pattern :%s", pattern)
+		}
+
+		matchers = append(matchers, matcher)
+	}
+
+	var files []string
+
+	if len(matchers) == 0 || !fs.Exists(root) {
+		return files, nil
+	}
+
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+
+		if err != nil {
+			return err
+		}
+
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+
+		if err != nil {
+			return err
+		}
+
+		rel = filepath.ToSlash(rel)
+
+		for _, matcher := range matchers {
+			if matcher.MatchString(rel) {
+				files = append(files, rel)
+				break
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, gserrors.Newf(err, "glob files error\n\t%s", root)
+	}
+
+	sort.Strings(files)
+
+	return files, nil
+}
+
+// hashfiles write relative path and content of files into hash
+func hashfiles(root string, files []string, hash io.Writer) error {
+
+	for _, file := range files {
+
+		fmt.Fprintf(hash, "file %s\n", file)
+
+		f, err := os.Open(filepath.Join(root, filepath.FromSlash(file)))
+
+		if err != nil {
+			return gserrors.Newf(err, "open file error\n\t%s", file)
+		}
+
+		_, err = io.Copy(hash, f)
+
+		f.Close()
+
+		if err != nil {
+			return gserrors.Newf(err, "read file error\n\t%s", file)
+		}
+	}
+
+	return nil
+}
+
+func (runner *Runner) fingerprintfile(task *TaskCmd) string {
+
+	hash := sha1.Sum([]byte(task.Project + "#" + task.Name))
+
+	dir := filepath.Join(runner.rootfs.Userspace(), "fingerprint")
+
+	// the snapshot of relocatable runner is read-only, keep the fingerprints in the per-process temp dir
+	if runner.relocatable {
+		dir = filepath.Join(runner.rootfs.TempDir("task"), "fingerprint")
+	}
+
+	return filepath.Join(dir, hex.EncodeToString(hash[:])+".json")
+}
+
+// inputsHash calc the hash of task inputs, args, selected domain and the version and sources digest of
+// package which defined the task
+func (runner *Runner) inputsHash(task *TaskCmd, domain string, args []string) (string, error) {
+
+	hash := sha1.New()
+
+	fmt.Fprintf(hash, "task %s#%s\nversion %s\ndigest %s\ndomain %s\n", task.Project, task.Name, task.Version, task.Digest, domain)
+
+	for _, arg := range args {
+		fmt.Fprintf(hash, "arg %s\n", arg)
+	}
+
+	if task.Inputs != nil {
+
+		for _, name := range task.Inputs.Properties {
+
+			content, err := json.Marshal(runner.currentpkg.Properties[name])
+
+			if err != nil {
+				return "", gserrors.Newf(err, "marshal input property %s error", name)
+			}
+
+			fmt.Fprintf(hash, "property %s %s\n", name, content)
+		}
+
+		files, err := globfiles(runner.targetpath, task.Inputs.Files)
+
+		if err != nil {
+			return "", err
+		}
+
+		if err := hashfiles(runner.targetpath, files, hash); err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// outputsHash calc the hash of task outputs
+func (runner *Runner) outputsHash(task *TaskCmd) (string, error) {
+
+	hash := sha1.New()
+
+	files, err := globfiles(runner.targetpath, task.Outputs)
+
+	if err != nil {
+		return "", err
+	}
+
+	if err := hashfiles(runner.targetpath, files, hash); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// uptodate check if task's inputs and outputs not changed since last successful run,
+// the returns fingerprint is nil if task declares no outputs
+func (runner *Runner) uptodate(task *TaskCmd, domain string, args []string) (*fingerprint, bool, error) {
+
+	if len(task.Outputs) == 0 {
+		return nil, false, nil
+	}
+
+	inputs, err := runner.inputsHash(task, domain, args)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	current := &fingerprint{Inputs: inputs}
+
+	if runner.rerun {
+		return current, false, nil
+	}
+
+	content, err := ioutil.ReadFile(runner.fingerprintfile(task))
+
+	if err != nil {
+		return current, false, nil
+	}
+
+	var last fingerprint
+
+	if err := json.Unmarshal(content, &last); err != nil {
+		return current, false, nil
+	}
+
+	if last.Inputs != inputs {
+		return current, false, nil
+	}
+
+	outputs, err := runner.outputsHash(task)
+
+	if err != nil {
+		return nil, false, err
+	}
+
+	current.Values = last.Values
+
+	return current, last.Outputs == outputs, nil
+}
+
+// record save the fingerprint after task successful run
+func (runner *Runner) record(task *TaskCmd, current *fingerprint) error {
+
+	outputs, err := runner.outputsHash(task)
+
+	if err != nil {
+		return err
+	}
+
+	current.Outputs = outputs
+
+	current.Values = runner.state.dump(task)
+
+	content, err := json.Marshal(current)
+
+	if err != nil {
+		return gserrors.Newf(err, "marshal task fingerprint error")
+	}
+
+	path := runner.fingerprintfile(task)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return gserrors.Newf(err, "create fingerprint dir error\n\t%s", path)
+	}
+
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		return gserrors.Newf(err, "write task fingerprint error\n\t%s", path)
+	}
+
+	return nil
+}
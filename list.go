@@ -0,0 +1,250 @@
+package gsmake
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/gsdocker/gserrors"
+)
+
+// TaskInfo the task description of gsmake list
+type TaskInfo struct {
+	Name        string         `json:"name"`                  // task name
+	Description string         `json:"description,omitempty"` // task description
+	Prev        []string       `json:"prev,omitempty"`        // prev task names
+	Packages    []*TaskPackage `json:"packages"`              // package contributions in run order
+}
+
+// TaskPackage the package contribution of task
+type TaskPackage struct {
+	Package     string `json:"package"`               // package name
+	Scope       string `json:"scope,omitempty"`       // scope belongs to, empty means all
+	Description string `json:"description,omitempty"` // description
+}
+
+// ListFilter the filter of gsmake list
+type ListFilter struct {
+	Domain  string // only list the contributions whose scope matches domain
+	Package string // only list the contributions of package
+}
+
+// match check if task matches the filter, selector is nil if no domain filter
+func (filter *ListFilter) match(selector *scopeSelector, task *TaskCmd) bool {
+
+	if selector != nil {
+		if _, reason := selector.match(task); reason != "" {
+			return false
+		}
+	}
+
+	return filter.Package == "" || task.Project == filter.Package
+}
+
+// Tasks get the registered tasks sorted by name, the tasks without matched contribution are omitted,
+// returns error if the domain filter is invalid selector
+func (runner *Runner) Tasks(filter ListFilter) ([]*TaskInfo, error) {
+
+	var selector *scopeSelector
+
+	if filter.Domain != "" {
+
+		var err error
+
+		selector, err = runner.selectScope(filter.Domain)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var names []string
+
+	for name := range runner.tasks {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	var result []*TaskInfo
+
+	for _, name := range names {
+
+		group := runner.tasks[name]
+
+		info := &TaskInfo{Name: name, Description: group.description}
+
+		seen := make(map[string]bool)
+
+		for _, task := range group.group {
+
+			if !filter.match(selector, task) {
+				continue
+			}
+
+			info.Packages = append(info.Packages, &TaskPackage{
+				Package:     task.Project,
+				Scope:       task.Scope,
+				Description: task.Description,
+			})
+
+			for _, prev := range task.Prev {
+				if !seen[prev] {
+					seen[prev] = true
+					info.Prev = append(info.Prev, prev)
+				}
+			}
+		}
+
+		if len(info.Packages) != 0 {
+			result = append(result, info)
+		}
+	}
+
+	return result, nil
+}
+
+// PrintTasks print registered tasks in text, tree or json format
+func (runner *Runner) PrintTasks(writer io.Writer, filter ListFilter, format string) error {
+
+	tasks, err := runner.Tasks(filter)
+
+	if err != nil {
+		return err
+	}
+
+	var stream bytes.Buffer
+
+	switch format {
+	case "text":
+
+		stream.WriteString("task list:\n")
+
+		for _, info := range tasks {
+
+			stream.WriteString(fmt.Sprintf("\t* %s\n", info.Name))
+
+			if len(info.Prev) != 0 {
+				stream.WriteString(fmt.Sprintf("\t\tprev: %s\n", strings.Join(info.Prev, ", ")))
+			}
+
+			for i, pkg := range info.Packages {
+
+				scope := strings.ToUpper(pkg.Scope)
+
+				if scope == "" {
+					scope = "ALL"
+				}
+
+				stream.WriteString(
+					fmt.Sprintf(
+						"\t\t%d). package:     %s\n\t\t    description: %s\n\t\t    scope:       %s\n",
+						i+1,
+						pkg.Package,
+						pkg.Description,
+						scope,
+					),
+				)
+			}
+		}
+
+	case "tree":
+
+		for _, info := range tasks {
+
+			stream.WriteString(info.Name)
+
+			if info.Description != "" {
+				stream.WriteString(" -- " + info.Description)
+			}
+
+			stream.WriteString("\n")
+
+			runner.printTree(&stream, info.Prev, "", []string{info.Name}, make(map[string]bool))
+		}
+
+	case "json":
+
+		content, err := json.MarshalIndent(tasks, "", "  ")
+
+		if err != nil {
+			return gserrors.Newf(err, "marshal task list error")
+		}
+
+		stream.Write(content)
+		stream.WriteString("\n")
+
+	default:
+		return gserrors.Newf(ErrTask, "unsupport task list format :%s", format)
+	}
+
+	_, err = writer.Write(stream.Bytes())
+
+	return err
+}
+
+// printTree print prev tasks recursively, path is the tasks from root to detect circular dependency,
+// the prev tasks of a task already printed in the tree are omitted, so the shared dependencies don't blow up the tree
+func (runner *Runner) printTree(stream *bytes.Buffer, prevs []string, indent string, path []string, printed map[string]bool) {
+
+	for i, prev := range prevs {
+
+		branch, next := "|-- ", "|   "
+
+		if i == len(prevs)-1 {
+			branch, next = "`-- ", "    "
+		}
+
+		circular := false
+
+		for _, name := range path {
+			if name == prev {
+				circular = true
+			}
+		}
+
+		if circular {
+			stream.WriteString(fmt.Sprintf("%s%s%s (circular)\n", indent, branch, prev))
+			continue
+		}
+
+		group, ok := runner.lookup(splitTaskPackage(prev))
+
+		if !ok {
+			stream.WriteString(fmt.Sprintf("%s%s%s (unknown)\n", indent, branch, prev))
+			continue
+		}
+
+		var children []string
+
+		seen := make(map[string]bool)
+
+		for _, task := range group.group {
+			for _, child := range task.Prev {
+				if !seen[child] {
+					seen[child] = true
+					children = append(children, child)
+				}
+			}
+		}
+
+		if len(children) != 0 && printed[prev] {
+			stream.WriteString(fmt.Sprintf("%s%s%s (see above)\n", indent, branch, prev))
+			continue
+		}
+
+		printed[prev] = true
+
+		stream.WriteString(fmt.Sprintf("%s%s%s\n", indent, branch, prev))
+
+		runner.printTree(stream, children, indent+next, append(path, prev), printed)
+	}
+}
+
+// PrintTask print defined task list
+func (runner *Runner) PrintTask() {
+	runner.PrintTasks(runner.Stdout(), ListFilter{}, "text")
+}
@@ -0,0 +1,157 @@
+package gsmake
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestListContributionOrder(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	runner.Task(&TaskCmd{Name: "build", Project: "app", Order: 2})
+	runner.Task(&TaskCmd{Name: "build", Project: "golang", Order: 0})
+	runner.Task(&TaskCmd{Name: "build", Project: "proto", Order: 1, After: []string{"app"}})
+
+	if err := runner.tasks["build"].order(); err != nil {
+		t.Fatal(err)
+	}
+
+	tasks, err := runner.Tasks(ListFilter{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+
+	for _, pkg := range tasks[0].Packages {
+		names = append(names, pkg.Package)
+	}
+
+	// the contributions are listed in run order instead of registering order
+	if order := strings.Join(names, " "); order != "golang app proto" {
+		t.Fatalf("expect listed order golang app proto, got %s", order)
+	}
+}
+
+func newListRunner() *Runner {
+
+	runner := NewRunner("", "")
+
+	runner.Task(&TaskCmd{Name: "test", Project: "golang", Scope: "golang", Prev: []string{"compile", "gen"}})
+	runner.Task(&TaskCmd{Name: "compile", Project: "golang", Scope: "golang", Prev: []string{"gen"}, Description: "compile sources"})
+	runner.Task(&TaskCmd{Name: "gen", Project: "proto", Scope: "proto", Prev: []string{"setup"}})
+	runner.Task(&TaskCmd{Name: "gen", Project: "golang", Scope: "golang"})
+	runner.Task(&TaskCmd{Name: "setup", Project: "app"})
+
+	return runner
+}
+
+func TestListTasks(t *testing.T) {
+
+	runner := newListRunner()
+
+	cases := []struct {
+		filter ListFilter
+		expect string
+	}{
+		{ListFilter{}, "compile gen setup test"},
+		{ListFilter{Domain: "proto"}, "gen setup"},
+		{ListFilter{Package: "golang"}, "compile gen test"},
+		{ListFilter{Domain: "proto", Package: "golang"}, ""},
+	}
+
+	for _, c := range cases {
+
+		tasks, err := runner.Tasks(c.filter)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+
+		for _, info := range tasks {
+			names = append(names, info.Name)
+		}
+
+		if got := strings.Join(names, " "); got != c.expect {
+			t.Fatalf("filter %+v expect tasks %s, got %s", c.filter, c.expect, got)
+		}
+	}
+
+	if err := runner.PrintTasks(&bytes.Buffer{}, ListFilter{Domain: "go*"}, "text"); err == nil {
+		t.Fatal("expect invalid domain selector error")
+	}
+
+	if err := runner.PrintTasks(&bytes.Buffer{}, ListFilter{}, "xml"); err == nil {
+		t.Fatal("expect unsupported format error")
+	}
+}
+
+func TestListJSON(t *testing.T) {
+
+	runner := newListRunner()
+
+	var buff bytes.Buffer
+
+	if err := runner.PrintTasks(&buff, ListFilter{Domain: "proto|golang"}, "json"); err != nil {
+		t.Fatal(err)
+	}
+
+	var tasks []map[string]interface{}
+
+	if err := json.Unmarshal(buff.Bytes(), &tasks); err != nil {
+		t.Fatalf("unmarshal task list error :%s\n%s", err, buff.String())
+	}
+
+	expect := map[string]interface{}{
+		"name": "gen",
+		"prev": []interface{}{"setup"},
+		"packages": []interface{}{
+			map[string]interface{}{"package": "golang", "scope": "golang"},
+			map[string]interface{}{"package": "proto", "scope": "proto"},
+		},
+	}
+
+	if len(tasks) != 4 || !reflect.DeepEqual(tasks[1], expect) {
+		t.Fatalf("expect json task %v\n\tgot :%s", expect, buff.String())
+	}
+}
+
+func TestListTree(t *testing.T) {
+
+	runner := newListRunner()
+
+	runner.Task(&TaskCmd{Name: "setup", Project: "cycle", Prev: []string{"test"}})
+
+	var buff bytes.Buffer
+
+	if err := runner.PrintTasks(&buff, ListFilter{Package: "golang"}, "tree"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the shared dependency gen is expanded once per tree
+	expect := `compile -- compile sources
+` + "`" + `-- gen
+    ` + "`" + `-- setup
+        ` + "`" + `-- test
+            |-- compile (circular)
+            ` + "`" + `-- gen (circular)
+gen
+test
+|-- compile
+|   ` + "`" + `-- gen
+|       ` + "`" + `-- setup
+|           ` + "`" + `-- test (circular)
+` + "`" + `-- gen (see above)
+`
+
+	if buff.String() != expect {
+		t.Fatalf("expect tree :\n%s\n\tgot :\n%s", expect, buff.String())
+	}
+}
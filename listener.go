@@ -0,0 +1,86 @@
+package gsmake
+
+import (
+	"time"
+
+	"github.com/gsmake/gsmake/vfs"
+)
+
+// Listener runner lifecycle listener, the nil callbacks are ignored,
+// in parallel mode the callbacks may be called concurrently
+type Listener struct {
+	OnTaskStart   func(runner *Runner, task *TaskCmd)                                   // called before executing task function
+	OnTaskFinish  func(runner *Runner, task *TaskCmd, elapsed time.Duration, err error) // called after task function returned
+	OnTaskSkip    func(runner *Runner, task *TaskCmd, reason string)                    // called if task is skipped, e.g: up-to-date
+	OnBuildFinish func(runner *Runner, elapsed time.Duration, err error)                // called after all targets finished or failed
+	OnMount       func(runner *Runner, src, target string, err error)                   // called after tasks mount package
+}
+
+// ListenerF the listener constructor declared in the listeners field of .gsmake.json,
+// it's called by the generated init function before the runner started
+type ListenerF func(runner *Runner) *Listener
+
+// Listen register runner lifecycle listener, it should be called before the runner started
+func (runner *Runner) Listen(listener *Listener) {
+	if listener != nil {
+		runner.listeners = append(runner.listeners, listener)
+	}
+}
+
+// taskEvent emit task event and notify listeners
+func (runner *Runner) taskEvent(eventType string, task *TaskCmd, domain string, elapsed time.Duration, message string, err error) {
+
+	emitTask(eventType, task, domain, elapsed, message, err)
+
+	runner.notify(eventType, task, elapsed, message, err)
+}
+
+// notify call listeners' task callbacks
+func (runner *Runner) notify(eventType string, task *TaskCmd, elapsed time.Duration, message string, err error) {
+
+	for _, listener := range runner.listeners {
+
+		switch eventType {
+		case EventTaskStart:
+			if listener.OnTaskStart != nil {
+				listener.OnTaskStart(runner, task)
+			}
+		case EventTaskSkip:
+			if listener.OnTaskSkip != nil {
+				listener.OnTaskSkip(runner, task, message)
+			}
+		case EventTaskFinish, EventTaskFail:
+			if listener.OnTaskFinish != nil {
+				listener.OnTaskFinish(runner, task, elapsed, err)
+			}
+		}
+	}
+}
+
+func (runner *Runner) buildFinished(elapsed time.Duration, err error) {
+	for _, listener := range runner.listeners {
+		if listener.OnBuildFinish != nil {
+			listener.OnBuildFinish(runner, elapsed, err)
+		}
+	}
+}
+
+// listenedFS the rootfs notifies listeners of mounting
+type listenedFS struct {
+	vfs.RootFS         // mixin rootfs
+	runner     *Runner // runner
+}
+
+// Mount implement vfs.RootFS
+func (rootfs *listenedFS) Mount(src, target string) error {
+
+	err := rootfs.RootFS.Mount(src, target)
+
+	for _, listener := range rootfs.runner.listeners {
+		if listener.OnMount != nil {
+			listener.OnMount(rootfs.runner, src, target, err)
+		}
+	}
+
+	return err
+}
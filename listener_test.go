@@ -0,0 +1,201 @@
+package gsmake
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestListener(t *testing.T) {
+
+	runner := newTestRunner(t,
+		&TaskCmd{Name: "gen", Project: "github.com/gsmake/test", F: func(runner *Runner, args ...string) error {
+			return nil
+		}},
+		&TaskCmd{Name: "gen", Project: "github.com/gsmake/proto", Scope: "proto", F: func(runner *Runner, args ...string) error {
+			return nil
+		}},
+		&TaskCmd{Name: "build", Project: "github.com/gsmake/test", F: func(runner *Runner, args ...string) error {
+			return errors.New("build failed")
+		}},
+	)
+
+	var events []string
+
+	runner.Listen(&Listener{
+		OnTaskStart: func(runner *Runner, task *TaskCmd) {
+			events = append(events, "start "+task.Name)
+		},
+		OnTaskFinish: func(runner *Runner, task *TaskCmd, elapsed time.Duration, err error) {
+			events = append(events, "finish "+task.Name)
+		},
+		OnTaskSkip: func(runner *Runner, task *TaskCmd, reason string) {
+			events = append(events, "skip "+task.Project+" "+reason)
+		},
+		OnBuildFinish: func(runner *Runner, elapsed time.Duration, err error) {
+			if err != nil {
+				events = append(events, "build failed")
+			} else {
+				events = append(events, "build finished")
+			}
+		},
+	})
+
+	if err := runner.Run("golang:gen"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := runner.Run("build"); err == nil {
+		t.Fatal("expect build failed")
+	}
+
+	expect := "skip github.com/gsmake/proto scope proto is not selected by golang,start gen,finish gen,build finished,start build,finish build,build failed"
+
+	if got := strings.Join(events, ","); got != expect {
+		t.Fatalf("expect listener events :%s\n\tgot :%s", expect, got)
+	}
+}
+
+func TestListenerSymbols(t *testing.T) {
+
+	for _, symbol := range []string{"newListener", "New-Listener", "1Listener", ""} {
+		if err := checksymbols(&Package{Name: "github.com/gsmake/test", Listeners: []string{symbol}}); err == nil {
+			t.Fatalf("expect invalid listener symbol error :%s", symbol)
+		}
+	}
+
+	if err := checksymbols(&Package{Name: "github.com/gsmake/test", Listeners: []string{"NewListener"}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestListenerCodegen(t *testing.T) {
+
+	tpl, err := newTemplate()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	compiler := &AOTCompiler{tpl: tpl}
+
+	path := filepath.Join(dir, "proj_0.go")
+
+	pkg := &Package{Name: "github.com/gsmake/test", Listeners: []string{"NewListener", "NewNotifier"}}
+
+	if err := compiler.gencodes(pkg, path, "project.go"); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, expect := range []string{
+		`import task "github.com/gsmake/test/.gsmake"`,
+		"context.Listen(task.NewListener(context))",
+		"context.Listen(task.NewNotifier(context))",
+	} {
+		if !strings.Contains(string(content), expect) {
+			t.Fatalf("expect generated code contains :%s\n%s", expect, content)
+		}
+	}
+
+	// the package declares only listeners, the generated file must compile without the task registrations
+	if err := typecheck(content, "github.com/gsmake/test/.gsmake", "NewListener", "NewNotifier"); err != nil {
+		t.Fatalf("generated code doesn't compile :%s\n%s", err, content)
+	}
+}
+
+// typecheck type-check generated project file against fake gsmake and task packages,
+// the task package declares the listener constructors
+func typecheck(content []byte, taskpkg string, listeners ...string) error {
+
+	gsmake := types.NewPackage("github.com/gsmake/gsmake", "gsmake")
+
+	runner := types.NewNamed(types.NewTypeName(token.NoPos, gsmake, "Runner", nil), types.NewStruct(nil, nil), nil)
+	listener := types.NewNamed(types.NewTypeName(token.NoPos, gsmake, "Listener", nil), types.NewStruct(nil, nil), nil)
+
+	gsmake.Scope().Insert(runner.Obj())
+	gsmake.Scope().Insert(listener.Obj())
+
+	recv := types.NewVar(token.NoPos, gsmake, "runner", types.NewPointer(runner))
+	param := types.NewVar(token.NoPos, gsmake, "listener", types.NewPointer(listener))
+
+	runner.AddMethod(types.NewFunc(token.NoPos, gsmake, "Listen", types.NewSignature(recv, types.NewTuple(param), nil, false)))
+
+	gsmake.MarkComplete()
+
+	task := types.NewPackage(taskpkg, "tasks")
+
+	for _, name := range listeners {
+
+		sig := types.NewSignature(
+			nil,
+			types.NewTuple(types.NewVar(token.NoPos, task, "runner", types.NewPointer(runner))),
+			types.NewTuple(types.NewVar(token.NoPos, task, "", types.NewPointer(listener))),
+			false,
+		)
+
+		task.Scope().Insert(types.NewFunc(token.NoPos, task, name, sig))
+	}
+
+	task.MarkComplete()
+
+	fset := token.NewFileSet()
+
+	project, err := parser.ParseFile(fset, "proj_0.go", content, 0)
+
+	if err != nil {
+		return err
+	}
+
+	main, err := parser.ParseFile(fset, "main.go", "package main\nimport \"github.com/gsmake/gsmake\"\nvar context *gsmake.Runner\nfunc main() {}\n", 0)
+
+	if err != nil {
+		return err
+	}
+
+	config := types.Config{
+		Importer: importerF(func(path string) (*types.Package, error) {
+			switch path {
+			case gsmake.Path():
+				return gsmake, nil
+			case task.Path():
+				return task, nil
+			}
+
+			return nil, fmt.Errorf("unknown package %s", path)
+		}),
+	}
+
+	_, err = config.Check("main", fset, []*ast.File{main, project}, nil)
+
+	return err
+}
+
+// importerF the function implements types.Importer
+type importerF func(path string) (*types.Package, error)
+
+func (f importerF) Import(path string) (*types.Package, error) {
+	return f(path)
+}
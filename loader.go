@@ -8,6 +8,7 @@ import (
 	"io/ioutil"
 	"net/url"
 	"path/filepath"
+	"regexp"
 	"strings"
 	"time"
 
@@ -56,8 +57,12 @@ func load(rootfs vfs.RootFS, imports []Import) (*Loader, error) {
 
 	start := time.Now()
 
+	finish := Phase("load")
+
 	err := loader.load()
 
+	finish(err)
+
 	if err != nil {
 		return nil, err
 	}
@@ -114,6 +119,12 @@ func (loader *Loader) load() error {
 		return err
 	}
 
+	core, err := coreVersion(pkg)
+
+	if err != nil {
+		return err
+	}
+
 	domains := ParseDomain(pkg.Domain, DomainDefault)
 
 	hasTask := false
@@ -156,12 +167,14 @@ func (loader *Loader) load() error {
 
 	loader.D("loaded domain : [%s]", strings.Join(domains, ","))
 
+	loader.D("gsmake core version : %s", core)
+
 	// try load gsmake
 	if _, ok := loader.querypackage("task", "github.com/gsmake/gsmake"); !ok {
 
 		pkg, err := loader.loadpackage(Import{
 			Name:    "github.com/gsmake/gsmake",
-			Version: VersionGSMake,
+			Version: core,
 			SCM:     "git",
 			Domain:  "task",
 		})
@@ -218,9 +231,13 @@ func (loader *Loader) tryMount(domain, name, srcpath, version, scm string) (stri
 
 	if !loader.rootfs.Mounted(src, target) {
 
+		start := time.Now()
+
 		if err := loader.rootfs.Mount(src, target); err != nil {
 			return src, target, err
 		}
+
+		emit(Event{Type: EventMount, Name: target, Domain: domain, Elapsed: time.Now().Sub(start), Message: src})
 	}
 
 	return src, target, nil
@@ -333,7 +350,30 @@ func (loader *Loader) loadpackagev2(currentDomain, name, fullpath string) (*Pack
 		}
 	}
 
-	for _, task := range pkg.Task {
+	for taskname, task := range pkg.Task {
+
+		if strings.Contains(taskname, "#") {
+			return nil, gserrors.Newf(ErrLoad, "invalid task name :%s\n\tpackage :%s\n\t'#' is reserved for package#task syntax", taskname, name)
+		}
+
+		if task.Timeout != "" {
+			if _, err := time.ParseDuration(task.Timeout); err != nil {
+				return nil, gserrors.Newf(err, "invalid task timeout :%s\n\tpackage :%s\n\ttask :%s", task.Timeout, name, taskname)
+			}
+		}
+
+		if task.RetryDelay != "" {
+			if _, err := time.ParseDuration(task.RetryDelay); err != nil {
+				return nil, gserrors.Newf(err, "invalid task retry delay :%s\n\tpackage :%s\n\ttask :%s", task.RetryDelay, name, taskname)
+			}
+		}
+
+		for _, pattern := range task.RetryOn {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return nil, gserrors.Newf(err, "invalid task retry pattern :%s\n\tpackage :%s\n\ttask :%s", pattern, name, taskname)
+			}
+		}
+
 		task.Package = name
 	}
 
@@ -13,20 +13,44 @@ type Import struct {
 
 // Task package defined task description
 type Task struct {
-	Prev        []string // depend task name
-	Description string   // task description
-	Domain      string   // scope belongs to
-	Package     string   `json:"-"` // package name which defined this task
+	Prev        []string          // depend task name
+	Description string            // task description
+	Domain      string            // scope belongs to
+	Func        string            // explicit bind task function name, default is TaskSymbol(task name)
+	Cmd         string            // shell command line run instead of task function, the args are positional parameters
+	Exclusive   bool              // exclusive task never runs with other tasks concurrently
+	Inputs      *TaskInputs       // declared inputs for up-to-date checking
+	Outputs     []string          // declared output file globs for up-to-date checking
+	VarArgs     bool              // consume all following command line words as args
+	Timeout     string            // task timeout duration, e.g: 10m
+	Always      bool              // always run even if the run failed
+	FinalizedBy []string          // finalizer task names, run after this task even if it failed
+	Retries     int               // max retry times after task failed
+	RetryDelay  string            // the delay duration before first retry, doubles after every retry
+	RetryOn     []string          // retry only if the error message matches any regexp patterns
+	Before      []string          // run before the contributions of these packages to the same task
+	After       []string          // run after the contributions of these packages to the same task
+	Args        []string          // default args, used when neither target args nor --task.arg overrides reach the task
+	Env         map[string]string // task environment variables, the values are expanded by properties
+	Flags       []string          // declared flags for shell completion
+	Package     string            `json:"-"` // package name which defined this task
 }
 
 // Package describe a gsmake package object
 type Package struct {
-	Name       string              // package name string
-	Domain     string              // package usage scope
-	Import     []Import            // package import field
-	Task       map[string]*Task    // package defined task
-	Properties property.Properties // properties
-	Version    string              // package version
-	Redirect   *Import             // package redirect instruction
-	loadPath   []*Package          // package load path
+	Name       string                       // package name string
+	Domain     string                       // package usage scope
+	Import     []Import                     // package import field
+	Task       map[string]*Task             // package defined task
+	Properties property.Properties          // properties
+	Version    string                       // package version
+	Redirect   *Import                      // package redirect instruction
+	GSMake     *Core                        // gsmake core requirement, only used by root package
+	Order      int                          `json:"-"` // dependency order, imported packages are smaller
+	Digest     string                       `json:"-"` // the hash of .gsmake.json and .gsmake sources
+	Env        map[string]string            // package environment variables, the values are expanded by properties
+	DomainEnv  map[string]map[string]string // environment variables of domains, indexed by domain name
+	Watch      *WatchConfig                 // watch mode config
+	Listeners  []string                     // runner listener constructors, see ListenerF
+	loadPath   []*Package                   // package load path
 }
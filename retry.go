@@ -0,0 +1,79 @@
+package gsmake
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// retryable check if the task failure matches task's retry error patterns,
+// any failure is retryable if the task declares no patterns
+func (task *TaskCmd) retryable(err error) bool {
+
+	if len(task.RetryOn) == 0 {
+		return true
+	}
+
+	for _, pattern := range task.RetryOn {
+
+		matcher, e := regexp.Compile(pattern)
+
+		if e != nil {
+			continue
+		}
+
+		if matcher.MatchString(err.Error()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// retry call task function in domain with task's retry policy, the retry delay doubles after every failed attempt
+func (runner *Runner) retry(task *TaskCmd, domain string, args []string) error {
+
+	delay := task.RetryDelay
+
+	for attempt := 1; ; attempt++ {
+
+		startime := time.Now()
+
+		err := runner.call(task, args)
+
+		elapsed := time.Now().Sub(startime)
+
+		if err == nil {
+
+			if attempt > 1 {
+
+				runner.W("%s:%s passed after %d attempts, the last attempt took %s", task.Project, task.Name, attempt, elapsed)
+
+				runner.state.flake(task, attempt)
+			}
+
+			return nil
+		}
+
+		if attempt > task.Retries || runner.canceled() || !task.retryable(err) {
+
+			if attempt > 1 {
+				runner.E("%s:%s failed after %d attempts, the last attempt took %s", task.Project, task.Name, attempt, elapsed)
+			}
+
+			return err
+		}
+
+		runner.W("%s:%s attempt %d/%d failed after %s, retry in %s\n%s", task.Project, task.Name, attempt, task.Retries+1, elapsed, delay, err)
+
+		emitTask(EventTaskRetry, task, domain, elapsed, fmt.Sprintf("attempt %d/%d", attempt, task.Retries+1), err)
+
+		select {
+		case <-time.After(delay):
+		case <-runner.ctx.Done():
+			return err
+		}
+
+		delay *= 2
+	}
+}
@@ -0,0 +1,105 @@
+package gsmake
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// eventRecorder record the emitted build events
+type eventRecorder struct {
+	sync.Mutex
+	events []*Event
+}
+
+func (recorder *eventRecorder) Emit(event *Event) {
+	recorder.Lock()
+	defer recorder.Unlock()
+
+	recorder.events = append(recorder.events, event)
+}
+
+func TestTaskRetry(t *testing.T) {
+
+	recorder := &eventRecorder{}
+
+	sinksLocker.Lock()
+	registered := sinks
+	sinks = []EventSink{recorder}
+	sinksLocker.Unlock()
+
+	defer func() {
+		sinksLocker.Lock()
+		sinks = registered
+		sinksLocker.Unlock()
+	}()
+
+	runner := NewRunner("", "")
+
+	attempts := 0
+
+	runner.Task(&TaskCmd{Name: "flaky", Project: "golang", Scope: "golang", Retries: 3, RetryDelay: time.Millisecond, F: func(*Runner, ...string) error {
+		attempts++
+
+		if attempts < 3 {
+			return errors.New("connection reset")
+		}
+
+		return nil
+	}})
+
+	if err := runner.RunTargets(Target{Name: "golang:flaky"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if attempts != 3 {
+		t.Fatalf("expect task passed at the third attempt, got %d attempts", attempts)
+	}
+
+	var retries int
+
+	for _, event := range recorder.events {
+		if event.Type == EventTaskRetry {
+
+			retries++
+
+			if event.Domain != "golang" {
+				t.Fatalf("expect retry event in golang domain, got %s", event.Domain)
+			}
+		}
+	}
+
+	if retries != 2 {
+		t.Fatalf("expect 2 retry events, got %d", retries)
+	}
+
+	if summary := runner.state.flakySummary(); summary != "\t* golang:flaky passed after 3 attempts\n" {
+		t.Fatalf("unexpected flaky summary :%s", summary)
+	}
+}
+
+func TestTaskRetryOn(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	attempts := 0
+
+	runner.Task(&TaskCmd{Name: "deploy", Retries: 3, RetryOn: []string{"timeout"}, F: func(*Runner, ...string) error {
+		attempts++
+		return errors.New("permission denied")
+	}})
+
+	if err := runner.Run("deploy"); err == nil {
+		t.Fatal("expect deploy error")
+	}
+
+	// the failure not matching any pattern is never retried
+	if attempts != 1 {
+		t.Fatalf("expect no retry, got %d attempts", attempts)
+	}
+
+	if summary := runner.state.flakySummary(); summary != "" {
+		t.Fatalf("expect no flaky tasks, got %s", summary)
+	}
+}
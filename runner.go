@@ -2,10 +2,15 @@ package gsmake
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/gsdocker/gserrors"
@@ -21,12 +26,32 @@ var (
 
 // TaskCmd gsmake task
 type TaskCmd struct {
-	Name        string   // task name
-	Description string   // task description
-	F           TaskF    // task function
-	Prev        []string // prev task name
-	Project     string   // project belongs to
-	Scope       string   // scope belongs to
+	Name        string                       // task name
+	Description string                       // task description
+	F           TaskF                        // task function
+	Prev        []string                     // prev task name
+	Project     string                       // project belongs to
+	Scope       string                       // scope belongs to
+	Exclusive   bool                         // exclusive task never runs with other tasks concurrently
+	Inputs      *TaskInputs                  // declared inputs
+	Outputs     []string                     // declared output file globs
+	Version     string                       // the version of package which defined this task
+	Digest      string                       // the hash of .gsmake.json and .gsmake sources of package which defined this task
+	VarArgs     bool                         // consume all following command line words as args
+	Timeout     time.Duration                // task timeout, zero means never timeout, see Runner.Context for the limitation
+	Always      bool                         // always run even if the run failed
+	FinalizedBy []string                     // finalizer task names, run after this task even if it failed
+	Retries     int                          // max retry times after task failed
+	RetryDelay  time.Duration                // the delay before first retry, doubles after every retry
+	RetryOn     []string                     // retry only if the error message matches any regexp patterns
+	Order       int                          // dependency order of the package defined this task, imported packages are smaller
+	Before      []string                     // run before the contributions of these packages to the same task
+	After       []string                     // run after the contributions of these packages to the same task
+	Args        []string                     // default args
+	Env         map[string]string            // task environment variables
+	PackageEnv  map[string]string            // environment variables of the package which defined this task
+	DomainEnv   map[string]map[string]string // domain environment variables of the package which defined this task
+	Cmd         string                       // shell command line run if the task has no function
 }
 
 func (cmd *TaskCmd) String() string {
@@ -63,14 +88,109 @@ type taskGroup struct {
 	mark        visitMark  // visit mark
 }
 
+// add add package contribution into group, the contributions are kept in dependency order
 func (group *taskGroup) add(task *TaskCmd) {
 	group.group = append(group.group, task)
 
+	sort.SliceStable(group.group, func(i, j int) bool {
+		return group.group[i].less(group.group[j])
+	})
+
 	if group.description == "" {
 		group.description = task.Description
 	}
 }
 
+func (task *TaskCmd) less(other *TaskCmd) bool {
+
+	if task.Order != other.Order {
+		return task.Order < other.Order
+	}
+
+	return task.Project < other.Project
+}
+
+// order apply the before/after constraints between package contributions,
+// the contributions without constraints between them keep dependency order
+func (group *taskGroup) order() error {
+
+	var (
+		indegree = make(map[*TaskCmd]int)
+		edges    = make(map[*TaskCmd][]*TaskCmd)
+	)
+
+	link := func(from *TaskCmd, pkg string, reverse bool) {
+		for _, to := range group.group {
+
+			if to.Project != pkg || to == from {
+				continue
+			}
+
+			if reverse {
+				edges[to] = append(edges[to], from)
+				indegree[from]++
+			} else {
+				edges[from] = append(edges[from], to)
+				indegree[to]++
+			}
+		}
+	}
+
+	for _, task := range group.group {
+
+		for _, pkg := range task.Before {
+			link(task, pkg, false)
+		}
+
+		for _, pkg := range task.After {
+			link(task, pkg, true)
+		}
+	}
+
+	var (
+		pending = append([]*TaskCmd(nil), group.group...)
+		result  []*TaskCmd
+	)
+
+	for len(pending) != 0 {
+
+		next := -1
+
+		// pending is in dependency order, so the first ready one is the smallest
+		for i, task := range pending {
+			if indegree[task] == 0 {
+				next = i
+				break
+			}
+		}
+
+		if next == -1 {
+
+			var names []string
+
+			for _, task := range pending {
+				names = append(names, task.Project)
+			}
+
+			return gserrors.Newf(ErrTask, "circular before/after constraints of task %s\n\tpackages :%s", group.name, strings.Join(names, ", "))
+		}
+
+		task := pending[next]
+
+		pending = append(pending[:next], pending[next+1:]...)
+
+		result = append(result, task)
+
+		for _, to := range edges[task] {
+			indegree[to]--
+		}
+	}
+
+	group.group = result
+
+	return nil
+}
+
 func (group *taskGroup) unmark() {
 	group.mark = white
 }
@@ -111,7 +231,9 @@ func (group *taskGroup) topoShort(context *Runner) ([]*taskGroup, error) {
 	for _, task := range group.group {
 
 		for _, prev := range task.Prev {
-			if prev, ok := context.tasks[prev]; ok {
+			pkg, name := splitTaskPackage(prev)
+
+			if prev, ok := context.lookup(pkg, name); ok {
 				r, err := prev.topoShort(context)
 
 				if err != nil {
@@ -132,50 +254,140 @@ func (group *taskGroup) topoShort(context *Runner) ([]*taskGroup, error) {
 	return result, nil
 }
 
-func (group *taskGroup) invoke(runner *Runner, domain string, args ...string) error {
+func (group *taskGroup) invoke(runner *Runner, selected string, args ...string) error {
+
+	selector, err := runner.selectScope(selected)
+
+	if err != nil {
+		return err
+	}
 
 	for _, task := range group.group {
 
-		scope := task.Scope
+		// the scope is checked first, so the task skipped in this domain still runs for other targets' domains
+		domain, reason := selector.match(task)
 
-		if scope != "" {
+		if reason != "" {
 
-			scopes := strings.Split(scope, "|")
+			runner.I("skip task %s:%s : %s", task.Project, task.Name, reason)
 
-			skip := true
+			runner.taskEvent(EventTaskSkip, task, selected, 0, reason, nil)
 
-			for _, v := range scopes {
-				if v == domain {
-					skip = false
-					break
-				}
+			continue
+		}
 
-				if v == "all" {
-					skip = false
-					break
-				}
+		run, first := runner.state.execute(task, domain)
+
+		if !first {
+
+			// the task is executed by other group in current run, e.g: package#task subgroup
+			if err := run.wait(); err != nil {
+				return gserrors.Newf(err, "task %s:%s failed", task.Project, task.Name)
 			}
 
-			if skip {
+			continue
+		}
 
-				runner.I("skip task\n%s", task)
+		err := run.execute(func() error {
+			return runner.invokeTask(task, domain, args)
+		})
 
-				continue
-			}
-		} else {
-			scope = "ALL"
+		if err != nil {
+			return err
 		}
+	}
+
+	return nil
+}
 
-		runner.I("exec %s", task)
+// invokeTask execute task in domain, the up-to-date and cached tasks are skipped
+func (runner *Runner) invokeTask(task *TaskCmd, domain string, args []string) error {
 
-		startime := time.Now()
+	taskrunner := runner.fork(task)
 
-		if err := task.F(runner, args...); err != nil {
+	taskrunner.domain = domain
+
+	// the manifest declared default args are used only if neither target args nor overrides reach the task
+	taskargs := args
+
+	if len(taskargs) == 0 {
+		taskargs = task.Args
+	}
+
+	current, uptodate, err := runner.uptodate(task, domain, taskargs)
+
+	if err != nil {
+		return err
+	}
+
+	if uptodate {
+		taskrunner.I("%s:%s UP-TO-DATE", task.Project, task.Name)
+
+		taskrunner.taskEvent(EventTaskSkip, task, domain, 0, "up-to-date", nil)
+
+		runner.state.load(task, current.Values)
+
+		return runner.publish(task)
+	}
+
+	// --rerun-tasks forces executing, so the cached outputs are not restored either
+	if current != nil && !runner.rerun {
+
+		restored, err := runner.restore(task, current)
+
+		if err != nil {
 			return err
 		}
 
-		runner.I("exec task -- success %s", time.Now().Sub(startime))
+		if restored {
+
+			taskrunner.I("%s:%s FROM-CACHE", task.Project, task.Name)
+
+			taskrunner.taskEvent(EventTaskSkip, task, domain, 0, "from-cache", nil)
+
+			runner.state.load(task, current.Values)
+
+			if err := runner.publish(task); err != nil {
+				return err
+			}
+
+			if err := runner.record(task, current); err != nil {
+				taskrunner.W("record task fingerprint error\n%s", err)
+			}
+
+			return nil
+		}
+	}
+
+	taskrunner.I("exec %s", task)
+
+	startime := time.Now()
+
+	taskrunner.taskEvent(EventTaskStart, task, domain, 0, "", nil)
+
+	if err := taskrunner.retry(task, domain, taskargs); err != nil {
+
+		taskrunner.taskEvent(EventTaskFail, task, domain, time.Now().Sub(startime), "", err)
+
+		return err
+	}
+
+	taskrunner.I("exec task -- success %s", time.Now().Sub(startime))
+
+	taskrunner.taskEvent(EventTaskFinish, task, domain, time.Now().Sub(startime), "", nil)
 
+	if err := runner.publish(task); err != nil {
+		return err
+	}
+
+	if current != nil {
+		if err := runner.record(task, current); err != nil {
+			taskrunner.W("record task fingerprint error\n%s", err)
+		}
+
+		if err := runner.save(task, current); err != nil {
+			taskrunner.W("save task outputs into cache error\n%s", err)
+		}
 	}
 
 	return nil
@@ -183,26 +395,68 @@ func (group *taskGroup) invoke(runner *Runner, domain string, args ...string) er
 
 // Runner gsmake task runner
 type Runner struct {
-	gslogger.Log                       // mixin Logger
-	current      *Task                 // current execute task
-	tasks        map[string]*taskGroup // register tasks
-	checkerOfDCG []*taskGroup          // DCG check stack
-	rootfs       vfs.RootFS            // rootfs
-	rootpath     string                // gsmake root path
-	targetpath   string                // the processing root package path
-	currentpkg   *Package              // current handle package object
-	startdir     string                // runner start dir
+	gslogger.Log                         // mixin Logger
+	current      *TaskCmd                // current execute task
+	tasks        map[string]*taskGroup   // register tasks
+	subgroups    map[string]*taskGroup   // package#task groups
+	overrides    map[*taskGroup][]string // --task.arg=value overrides
+	state        *runState               // state shared by all tasks of current run
+	jobs         int                     // max concurrent running task groups
+	rerun        bool                    // ignore up-to-date checking
+	keepgoing    bool                    // continue running independent tasks after failure
+	dryrun       bool                    // print external commands without executing them
+	domain       string                  // selected domain of current task invocation
+	caches       []CacheBackend          // task outputs cache backends
+	ctx          context.Context         // the run context or current task context
+	cancel       context.CancelFunc      // cancel the run context
+	cancelOnce   *sync.Once              // cancel once
+	checkerOfDCG []*taskGroup            // DCG check stack
+	rootfs       vfs.RootFS              // rootfs
+	rootpath     string                  // gsmake root path
+	targetpath   string                  // the processing root package path
+	currentpkg   *Package                // current handle package object
+	startdir     string                  // runner start dir
+	stdout       io.Writer               // tasks stdout writer
+	stderr       io.Writer               // tasks stderr writer
+	relocatable  bool                    // relocatable runner flag
+	listeners    []*Listener             // lifecycle listeners
+	scopes       map[string][]string     // declared scope parents
 }
 
 // NewRunner create new task runner
 func NewRunner(rootpath string, targetpath string) *Runner {
 
+	ctx, cancel := context.WithCancel(context.Background())
+
 	runner := &Runner{
 		Log:        gslogger.Get("gsmake"),
+		ctx:        ctx,
+		cancel:     cancel,
+		cancelOnce: &sync.Once{},
 		tasks:      make(map[string]*taskGroup),
+		subgroups:  make(map[string]*taskGroup),
+		overrides:  make(map[*taskGroup][]string),
+		jobs:       1,
 		rootpath:   rootpath,
 		targetpath: targetpath,
 		startdir:   fs.Current(),
+		stdout:     os.Stdout,
+		stderr:     os.Stderr,
+	}
+
+	return runner
+}
+
+// NewRelocatableRunner create task runner which loads the userspace snapshot exported beside the runner binary,
+// the processing package is the runner start dir
+func NewRelocatableRunner() *Runner {
+
+	runner := NewRunner("", fs.Current())
+
+	runner.relocatable = true
+
+	if binarypath, err := os.Executable(); err == nil {
+		runner.rootpath = filepath.Dir(binarypath)
 	}
 
 	return runner
@@ -266,21 +520,91 @@ func (runner *Runner) RootFS() vfs.RootFS {
 	return runner.rootfs
 }
 
+// Jobs set max concurrent running task groups, n <= 1 means run tasks serially
+func (runner *Runner) Jobs(n int) {
+
+	if n < 1 {
+		n = 1
+	}
+
+	runner.jobs = n
+}
+
+// RerunTasks force executing tasks even if they are up-to-date
+func (runner *Runner) RerunTasks(rerun bool) {
+	runner.rerun = rerun
+}
+
+// ContinueOnError keep running the tasks not depend on the failed ones, and report all failed tasks at the end
+func (runner *Runner) ContinueOnError(keepgoing bool) {
+	runner.keepgoing = keepgoing
+}
+
+// DryRun print the external commands started by Exec without executing them
+func (runner *Runner) DryRun(dryrun bool) {
+	runner.dryrun = dryrun
+}
+
+// Domain get selected domain of current task invocation, it's empty if no domain selected
+func (runner *Runner) Domain() string {
+	return runner.domain
+}
+
+// UseCache add task outputs cache backend, the backends are searched in the order they are added,
+// and the local cache under gsmake root path is always the first one
+func (runner *Runner) UseCache(cache CacheBackend) {
+	runner.caches = append(runner.caches, cache)
+}
+
+// Current get current executing task, returns nil if called outside task function
+func (runner *Runner) Current() *TaskCmd {
+	return runner.current
+}
+
 // StartDir get runner start dir
 func (runner *Runner) StartDir() string {
 	return runner.startdir
 }
 
+// StartFrom change runner start dir
+func (runner *Runner) StartFrom(dir string) {
+	runner.startdir = dir
+}
+
+// Output redirect tasks stdout and stderr output
+func (runner *Runner) Output(stdout, stderr io.Writer) {
+	runner.stdout = stdout
+	runner.stderr = stderr
+}
+
 // Start .
 func (runner *Runner) Start() error {
 
-	rootfs, err := vfs.New(runner.rootpath, runner.targetpath)
+	var (
+		rootfs vfs.RootFS
+		err    error
+	)
+
+	if runner.relocatable {
+		rootfs, err = vfs.NewStatic(runner.rootpath, runner.targetpath)
+	} else {
+		rootfs, err = vfs.New(runner.rootpath, runner.targetpath)
+	}
 
 	if err != nil {
 		return err
 	}
 
-	runner.rootfs = rootfs
+	runner.rootfs = &listenedFS{RootFS: rootfs, runner: runner}
+
+	cachedir := filepath.Join(runner.rootpath, "taskcache")
+
+	// the snapshot of relocatable runner is read-only, keep the task cache in the per-process temp dir
+	if runner.relocatable {
+		cachedir = filepath.Join(rootfs.TempDir("task"), "taskcache")
+	}
+
+	runner.caches = append([]CacheBackend{NewFileCache(cachedir)}, runner.caches...)
 
 	jsonfile := filepath.Join(runner.targetpath, ".gsmake.json")
 
@@ -292,6 +616,18 @@ func (runner *Runner) Start() error {
 
 	runner.I("package name :%s", runner.Name())
 
+	runner.scopes, err = loadScopes(runner.currentpkg)
+
+	if err != nil {
+		return err
+	}
+
+	for _, group := range runner.tasks {
+		if err := group.order(); err != nil {
+			return err
+		}
+	}
+
 	return nil
 }
 
@@ -307,76 +643,234 @@ func (runner *Runner) Task(task *TaskCmd) {
 	group.add(task)
 }
 
-// PrintTask print defined task list
-func (runner *Runner) PrintTask() {
-	var stream bytes.Buffer
-	stream.WriteString("task list:\n")
-	for name, task := range runner.tasks {
-		stream.WriteString(fmt.Sprintf("\t* %s\n", name))
+func (runner *Runner) unmark() {
+	for _, group := range runner.tasks {
+		group.unmark()
+	}
 
-		for i, child := range task.group {
+	for _, group := range runner.subgroups {
+		group.unmark()
+	}
+}
 
-			scope := strings.ToUpper(child.Scope)
+// splitTaskPackage split package#task name
+func splitTaskPackage(name string) (string, string) {
 
-			if scope == "" {
-				scope = "ALL"
-			}
+	if index := strings.Index(name, "#"); index != -1 {
+		return name[:index], name[index+1:]
+	}
 
-			stream.WriteString(
-				fmt.Sprintf(
-					"\t\t%d). package:     %s\n\t\t    description: %s\n \t\t    scope:       %s\n",
-					i+1,
-					child.Project,
-					child.Description,
-					scope,
-				),
-			)
+	return "", name
+}
+
+// parseTaskName parse [domain:][package#]task syntax, the task name itself may contain ':'
+func (runner *Runner) parseTaskName(name string) (domain, pkg, task string) {
+
+	if index := strings.Index(name, "#"); index != -1 {
+
+		pkg, task = name[:index], name[index+1:]
+
+		if index := strings.Index(pkg, ":"); index != -1 {
+			domain, pkg = pkg[:index], pkg[index+1:]
 		}
 
+		return
 	}
 
-	runner.I("print tasks\n%s", stream.String())
-}
+	if _, ok := runner.tasks[name]; ok {
+		return "", "", name
+	}
 
-func (runner *Runner) unmark() {
-	for _, group := range runner.tasks {
-		group.unmark()
+	if index := strings.Index(name, ":"); index != -1 {
+		return name[:index], "", name[index+1:]
 	}
+
+	return "", "", name
 }
 
-// Run run task
-func (runner *Runner) Run(name string, args ...string) error {
+// lookup get task group by name, if pkg is not empty only the package's contribution is included
+func (runner *Runner) lookup(pkg, name string) (*taskGroup, bool) {
 
-	domain := ""
-	tokens := strings.SplitN(name, ":", 2)
+	group, ok := runner.tasks[name]
 
-	if len(tokens) == 2 {
+	if !ok || pkg == "" {
+		return group, ok
+	}
 
-		name = tokens[1]
+	key := pkg + "#" + name
 
-		domain = tokens[0]
+	if subgroup, ok := runner.subgroups[key]; ok {
+		return subgroup, true
+	}
+
+	subgroup := &taskGroup{name: key}
+
+	for _, task := range group.group {
+		if task.Project == pkg {
+			subgroup.add(task)
+		}
+	}
+
+	if len(subgroup.group) == 0 {
+		return nil, false
+	}
+
+	runner.subgroups[key] = subgroup
+
+	return subgroup, true
+}
+
+// resolve parse task name and get the topo sorted task groups
+func (runner *Runner) resolve(name string) (string, []*taskGroup, error) {
+
+	domain, pkg, name := runner.parseTaskName(name)
+
+	if _, err := runner.selectScope(domain); err != nil {
+		return "", nil, err
 	}
 
 	//DFS Topo sort
 
-	if group, ok := runner.tasks[name]; ok {
+	if group, ok := runner.lookup(pkg, name); ok {
 
 		result, err := group.topoShort(runner)
 
 		runner.unmark()
 
 		if err != nil {
-			return err
+			return "", nil, err
 		}
 
-		for _, group := range result {
-			if err := group.invoke(runner, domain, args...); err != nil {
-				return err
+		return domain, result, nil
+	}
+
+	if pkg != "" {
+		return "", nil, gserrors.Newf(ErrTask, "unknown task :%s#%s", pkg, name)
+	}
+
+	return "", nil, gserrors.Newf(ErrTask, "unknown task :%s", name)
+}
+
+// Run run task, the task name syntax is [domain:][package#]task, the domain can be
+// domain|domain..., * or !domain
+func (runner *Runner) Run(name string, args ...string) error {
+	return runner.RunTargets(Target{Name: name, Args: args})
+}
+
+// RunTargets run the union of targets' task groups in order
+func (runner *Runner) RunTargets(targets ...Target) error {
+
+	if len(targets) == 0 {
+		return gserrors.Newf(ErrTask, "expect task name")
+	}
+
+	items, err := runner.schedule(targets)
+
+	if err != nil {
+		return err
+	}
+
+	runner.state = newRunState()
+
+	start := time.Now()
+
+	finish := Phase("run")
+
+	err = newScheduler(runner, items).run()
+
+	finish(err)
+
+	runner.buildFinished(time.Now().Sub(start), err)
+
+	return err
+}
+
+// Plan print the execution plan of targets without running them
+func (runner *Runner) Plan(targets ...Target) error {
+
+	if len(targets) == 0 {
+		return gserrors.Newf(ErrTask, "expect task name")
+	}
+
+	items, err := runner.schedule(targets)
+
+	if err != nil {
+		return err
+	}
+
+	var names []string
+
+	for _, target := range targets {
+		names = append(names, target.String())
+	}
+
+	var stream bytes.Buffer
+
+	stream.WriteString(fmt.Sprintf("execution plan of %s\n", strings.Join(names, " ")))
+
+	planned := make(map[taskKey]bool)
+
+	for i, item := range items {
+
+		domain := item.domain
+
+		if domain == "" {
+			domain = "<none>"
+		}
+
+		if len(item.args) != 0 {
+			domain = fmt.Sprintf("%s, args: %s", domain, strings.Join(item.args, " "))
+		}
+
+		if len(item.finalizes) != 0 {
+
+			var finalized []string
+
+			for _, other := range item.finalizes {
+				finalized = append(finalized, other.group.name)
 			}
+
+			stream.WriteString(fmt.Sprintf("\t%d. %s, domain: %s, finalizer of: %s\n", i+1, item.group.name, domain, strings.Join(finalized, ",")))
+		} else {
+			stream.WriteString(fmt.Sprintf("\t%d. %s, domain: %s\n", i+1, item.group.name, domain))
 		}
 
-		return nil
+		selector, err := runner.selectScope(item.domain)
+
+		if err != nil {
+			return err
+		}
+
+		for _, task := range item.group.group {
+
+			scope := strings.ToUpper(task.Scope)
+
+			if scope == "" {
+				scope = "ALL"
+			}
+
+			action := "run"
+
+			if domain, reason := selector.match(task); reason != "" {
+				action = fmt.Sprintf("skip (%s)", reason)
+			} else if key := (taskKey{task: task, domain: domain}); planned[key] {
+				action = "skip (already planned)"
+			} else {
+				planned[key] = true
+			}
+
+			stream.WriteString(
+				fmt.Sprintf(
+					"\t\t* package:     %s\n\t\t  scope:       %s\n\t\t  action:      %s\n",
+					task.Project,
+					scope,
+					action,
+				),
+			)
+		}
 	}
 
-	return gserrors.Newf(ErrTask, "unknown task :%s", name)
+	runner.I("print plan\n%s", stream.String())
+
+	return nil
 }
@@ -0,0 +1,103 @@
+package gsmake
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTaskDefaultArgs(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	var got []string
+
+	runner.Task(&TaskCmd{Name: "create", Args: []string{"github.com/gsmake/archtype:golang"}, F: func(runner *Runner, args ...string) error {
+		got = append(got, strings.Join(args, " "))
+		return nil
+	}})
+
+	runner.Task(&TaskCmd{Name: "release", Prev: []string{"create"}, F: func(runner *Runner, args ...string) error {
+		return nil
+	}})
+
+	cases := []struct {
+		words  string
+		expect string
+	}{
+		{"create", "github.com/gsmake/archtype:golang"},
+		{"release", "github.com/gsmake/archtype:golang"},
+		{"create -o x pkg:arch", "-o x pkg:arch"},
+		{"--create.o=x release", "-o=x"},
+	}
+
+	for _, c := range cases {
+
+		got = nil
+
+		runner.overrides = make(map[*taskGroup][]string)
+
+		if err := runner.RunTargets(runner.ParseTargets(strings.Fields(c.words))...); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(got) != 1 || got[0] != c.expect {
+			t.Fatalf("%s expect create args %s, got %v", c.words, c.expect, got)
+		}
+	}
+}
+
+func TestParseTaskName(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	runner.Task(&TaskCmd{Name: "go:build", Project: "github.com/gsmake/golang"})
+
+	cases := map[string][3]string{
+		"build":                                {"", "", "build"},
+		"golang:build":                         {"golang", "", "build"},
+		"go:build":                             {"", "", "go:build"},
+		"golang:go:build":                      {"golang", "", "go:build"},
+		"github.com/gsmake/golang#go:build":    {"", "github.com/gsmake/golang", "go:build"},
+		"golang:github.com/gsmake/golang#test": {"golang", "github.com/gsmake/golang", "test"},
+	}
+
+	for name, expect := range cases {
+		domain, pkg, task := runner.parseTaskName(name)
+
+		if domain != expect[0] || pkg != expect[1] || task != expect[2] {
+			t.Fatalf("parse %s expect %v, got [%s %s %s]", name, expect, domain, pkg, task)
+		}
+	}
+}
+
+func TestTaskOrder(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	runner.Task(&TaskCmd{Name: "build", Project: "app", Order: 2})
+	runner.Task(&TaskCmd{Name: "build", Project: "golang", Order: 0})
+	runner.Task(&TaskCmd{Name: "build", Project: "proto", Order: 1, After: []string{"app"}})
+	runner.Task(&TaskCmd{Name: "build", Project: "lint", Order: 3, Before: []string{"golang"}})
+
+	group := runner.tasks["build"]
+
+	if err := group.order(); err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+
+	for _, task := range group.group {
+		names = append(names, task.Project)
+	}
+
+	if order := strings.Join(names, " "); order != "app proto lint golang" {
+		t.Fatalf("expect order app proto lint golang, got %s", order)
+	}
+
+	runner.Task(&TaskCmd{Name: "build", Project: "cycle", Order: 4, Before: []string{"proto"}, After: []string{"proto"}})
+
+	if err := runner.tasks["build"].order(); err == nil {
+		t.Fatal("expect circular constraints error")
+	}
+}
@@ -0,0 +1,522 @@
+package gsmake
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/gsdocker/gserrors"
+	"github.com/gsdocker/gslogger"
+)
+
+// runState the state shared by all task invocations of one run
+type runState struct {
+	sync.Mutex                       // state locker
+	executed   map[taskKey]*taskRun  // executed tasks
+	flakes     []flakyTask           // tasks passed after retrying
+	values     map[string]taskValues // values stored by tasks, indexed by package#task
+}
+
+// flakyTask the task passed after retrying
+type flakyTask struct {
+	task     *TaskCmd // task
+	attempts int      // attempt times
+}
+
+func newRunState() *runState {
+	return &runState{
+		executed: make(map[taskKey]*taskRun),
+		values:   make(map[string]taskValues),
+	}
+}
+
+// flake record the task passed after retrying
+func (state *runState) flake(task *TaskCmd, attempts int) {
+	state.Lock()
+	defer state.Unlock()
+
+	state.flakes = append(state.flakes, flakyTask{task: task, attempts: attempts})
+}
+
+// flakySummary get the summary lines of tasks passed after retrying, returns empty string if no flaky tasks
+func (state *runState) flakySummary() string {
+	state.Lock()
+	defer state.Unlock()
+
+	var stream bytes.Buffer
+
+	for _, flake := range state.flakes {
+		stream.WriteString(fmt.Sprintf("\t* %s:%s passed after %d attempts\n", flake.task.Project, flake.task.Name, flake.attempts))
+	}
+
+	return stream.String()
+}
+
+// taskKey the task executed in domain, the task runs once for every selected domain
+type taskKey struct {
+	task   *TaskCmd // task
+	domain string   // the domain task runs in
+}
+
+// taskRun the execution of task in current run, shared by all the groups contain the task
+type taskRun struct {
+	done chan struct{} // closed after task finished
+	err  error         // task error
+}
+
+// execute mark task as executed in domain, returns false if the task already executed or is executing in current run
+func (state *runState) execute(task *TaskCmd, domain string) (*taskRun, bool) {
+	state.Lock()
+	defer state.Unlock()
+
+	key := taskKey{task: task, domain: domain}
+
+	if run, ok := state.executed[key]; ok {
+		return run, false
+	}
+
+	run := &taskRun{done: make(chan struct{})}
+
+	state.executed[key] = run
+
+	return run, true
+}
+
+// execute call f and release the waiters after f returned, the waiters get error even if f panics
+func (run *taskRun) execute(f func() error) (err error) {
+
+	err = gserrors.Newf(ErrTask, "task panic")
+
+	defer func() {
+		run.err = err
+		close(run.done)
+	}()
+
+	err = f()
+
+	return
+}
+
+// wait wait for the task finished and get the task error
+func (run *taskRun) wait() error {
+
+	<-run.done
+
+	return run.err
+}
+
+// fork create runner view for task invocation, in parallel mode the logger is tagged by task name
+func (runner *Runner) fork(task *TaskCmd) *Runner {
+
+	taskrunner := *runner
+
+	taskrunner.current = task
+
+	if runner.jobs > 1 {
+		taskrunner.Log = gslogger.Get(task.Name)
+	}
+
+	return &taskrunner
+}
+
+// Stdout get the stdout writer for current task, in parallel mode every line is prefixed by task name
+func (runner *Runner) Stdout() io.Writer {
+
+	if runner.jobs > 1 && runner.current != nil {
+		return &prefixWriter{prefix: fmt.Sprintf("[%s] ", runner.current.Name), writer: runner.stdout}
+	}
+
+	return runner.stdout
+}
+
+// Stderr get the stderr writer for current task, in parallel mode every line is prefixed by task name
+func (runner *Runner) Stderr() io.Writer {
+
+	if runner.jobs > 1 && runner.current != nil {
+		return &prefixWriter{prefix: fmt.Sprintf("[%s] ", runner.current.Name), writer: runner.stderr}
+	}
+
+	return runner.stderr
+}
+
+// prefixWriter write every line with prefix
+type prefixWriter struct {
+	prefix  string    // line prefix
+	writer  io.Writer // underlying writer
+	newline bool      // the last write ends with newline
+	started bool      // written flag
+}
+
+func (writer *prefixWriter) Write(p []byte) (int, error) {
+
+	var buff bytes.Buffer
+
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+
+		if len(line) == 0 {
+			continue
+		}
+
+		if !writer.started || writer.newline {
+			buff.WriteString(writer.prefix)
+		}
+
+		writer.started = true
+
+		buff.Write(line)
+
+		writer.newline = line[len(line)-1] == '\n'
+	}
+
+	if _, err := writer.writer.Write(buff.Bytes()); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+func (group *taskGroup) exclusive() bool {
+	for _, task := range group.group {
+		if task.Exclusive {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (group *taskGroup) always() bool {
+	for _, task := range group.group {
+		if task.Always {
+			return true
+		}
+	}
+
+	return false
+}
+
+type invokeState int
+
+const (
+	invokePending   invokeState = iota // not finished
+	invokeSucceeded                    // invoke success
+	invokeFailed                       // invoke failed
+	invokeSkipped                      // never invoked because of failure or cancel
+)
+
+type invokeResult struct {
+	item *invocation // task group invocation
+	err  error       // invoke error
+}
+
+type invokeFailure struct {
+	name string // failed task group name
+	err  error  // invoke error
+}
+
+// scheduler run topo sorted task groups, the ready groups run concurrently up to runner's jobs
+type scheduler struct {
+	runner      *Runner                      // runner
+	items       []*invocation                // topo sorted task group invocations
+	invocations map[*taskGroup][]*invocation // the invocations of task group, one for every selected domain
+	deps        map[*taskGroup][]*taskGroup  // task group's prev groups
+	state       map[*invocation]invokeState  // invocation state
+	failures    []invokeFailure              // failed task groups
+}
+
+func newScheduler(runner *Runner, items []*invocation) *scheduler {
+
+	s := &scheduler{
+		runner:      runner,
+		items:       items,
+		invocations: make(map[*taskGroup][]*invocation),
+		deps:        make(map[*taskGroup][]*taskGroup),
+		state:       make(map[*invocation]invokeState),
+	}
+
+	for _, item := range items {
+
+		s.invocations[item.group] = append(s.invocations[item.group], item)
+
+		for _, task := range item.group.group {
+			for _, prev := range task.Prev {
+				if prev, ok := runner.lookup(splitTaskPackage(prev)); ok {
+					s.deps[item.group] = append(s.deps[item.group], prev)
+				}
+			}
+		}
+	}
+
+	return s
+}
+
+func (s *scheduler) invoke(item *invocation, results chan<- invokeResult) {
+
+	group := item.group
+
+	var err error
+
+	defer func() {
+		if e := recover(); e != nil {
+			if perr, ok := e.(error); ok {
+				err = gserrors.Newf(perr, "task %s panic", group.name)
+			} else {
+				err = gserrors.Newf(ErrTask, "task %s panic :%v", group.name, e)
+			}
+		}
+
+		results <- invokeResult{item: item, err: err}
+	}()
+
+	err = group.invoke(s.runner, item.domain, item.args...)
+}
+
+// groupState get the state of all the group's invocations
+func (s *scheduler) groupState(group *taskGroup) invokeState {
+
+	result := invokeSucceeded
+
+	for _, item := range s.invocations[group] {
+
+		switch s.state[item] {
+		case invokePending:
+			return invokePending
+		case invokeFailed:
+			result = invokeFailed
+		case invokeSkipped:
+			if result == invokeSucceeded {
+				result = invokeSkipped
+			}
+		}
+	}
+
+	return result
+}
+
+// waiting check if any group or invocation which item depends on is not finished
+func (s *scheduler) waiting(item *invocation) bool {
+
+	for _, group := range s.deps[item.group] {
+		if s.groupState(group) == invokePending {
+			return true
+		}
+	}
+
+	for _, items := range [][]*invocation{item.after, item.finalizes} {
+		for _, other := range items {
+			if s.state[other] == invokePending {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// skipreason get the reason why the ready item must be skipped, returns empty string if it should run
+func (s *scheduler) skipreason(item *invocation) string {
+
+	if s.runner.canceled() {
+		return "run canceled"
+	}
+
+	always := item.group.always()
+
+	if len(item.finalizes) != 0 {
+
+		finalized := false
+
+		for _, other := range item.finalizes {
+			if state := s.state[other]; state == invokeSucceeded || state == invokeFailed {
+				finalized = true
+			}
+		}
+
+		if !finalized {
+			return "finalized task not executed"
+		}
+
+		always = true
+	}
+
+	if !always {
+
+		for _, prev := range s.deps[item.group] {
+			if s.groupState(prev) != invokeSucceeded {
+				return fmt.Sprintf("prev task %s not succeeded", prev.name)
+			}
+		}
+
+		if len(s.failures) != 0 && !s.runner.keepgoing {
+			return "run failed"
+		}
+	}
+
+	return ""
+}
+
+func (s *scheduler) run() error {
+
+	var (
+		queue     = append([]*invocation(nil), s.items...)
+		results   = make(chan invokeResult)
+		running   = 0
+		exclusive = false
+		jobs      = s.runner.jobs
+	)
+
+	if jobs < 1 {
+		jobs = 1
+	}
+
+	for {
+		progress := false
+
+		for i := 0; !exclusive && i < len(queue); {
+
+			item := queue[i]
+
+			if s.waiting(item) {
+				i++
+				continue
+			}
+
+			if reason := s.skipreason(item); reason != "" {
+
+				s.runner.I("skip task %s : %s", item.group.name, reason)
+
+				emit(Event{Type: EventTaskSkip, Name: item.group.name, Domain: item.domain, Message: reason})
+
+				for _, task := range item.group.group {
+					s.runner.notify(EventTaskSkip, task, 0, reason, nil)
+				}
+
+				s.state[item] = invokeSkipped
+
+				queue = append(queue[:i], queue[i+1:]...)
+
+				progress = true
+
+				// the skipped group may unblock the former items
+				i = 0
+
+				continue
+			}
+
+			if item.group.exclusive() {
+
+				// wait for running groups, and don't start any other group before it
+				if running > 0 {
+					break
+				}
+
+				exclusive = true
+			} else if running >= jobs {
+				break
+			}
+
+			queue = append(queue[:i], queue[i+1:]...)
+
+			running++
+
+			progress = true
+
+			go s.invoke(item, results)
+		}
+
+		if running == 0 {
+
+			if len(queue) == 0 {
+				break
+			}
+
+			if !progress {
+				for _, item := range queue {
+					s.runner.E("task %s can't be scheduled : unresolved dependency", item.group.name)
+
+					s.failures = append(s.failures, invokeFailure{
+						name: item.group.name,
+						err:  gserrors.Newf(ErrTask, "task %s can't be scheduled : unresolved dependency", item.group.name),
+					})
+				}
+
+				break
+			}
+
+			continue
+		}
+
+		r := <-results
+
+		running--
+
+		if r.item.group.exclusive() {
+			exclusive = false
+		}
+
+		if r.err != nil {
+
+			s.state[r.item] = invokeFailed
+
+			if running > 0 {
+				s.runner.E("task %s failed, wait for running tasks ...", r.item.group.name)
+			}
+
+			s.failures = append(s.failures, invokeFailure{name: r.item.group.name, err: r.err})
+
+		} else {
+			s.state[r.item] = invokeSucceeded
+		}
+	}
+
+	return s.report()
+}
+
+// skipped check if any invocation is skipped
+func (s *scheduler) skipped() bool {
+
+	for _, state := range s.state {
+		if state == invokeSkipped {
+			return true
+		}
+	}
+
+	return false
+}
+
+// report print the flaky and failed tasks summary and get the run result
+func (s *scheduler) report() error {
+
+	if summary := s.runner.state.flakySummary(); summary != "" {
+		s.runner.W("flaky tasks summary\n%s", summary)
+	}
+
+	if len(s.failures) == 0 {
+
+		if s.runner.canceled() && s.skipped() {
+			return gserrors.Newf(ErrCancel, "run canceled")
+		}
+
+		return nil
+	}
+
+	if len(s.failures) == 1 && !s.runner.keepgoing {
+		return s.failures[0].err
+	}
+
+	var stream bytes.Buffer
+
+	for _, failure := range s.failures {
+		stream.WriteString(fmt.Sprintf("\t* %s\n\t\t%s\n", failure.name, strings.Replace(failure.err.Error(), "\n", "\n\t\t", -1)))
+	}
+
+	s.runner.E("failed tasks summary\n%s", stream.String())
+
+	if len(s.failures) == 1 {
+		return s.failures[0].err
+	}
+
+	return gserrors.Newf(ErrTask, "%d tasks failed", len(s.failures))
+}
@@ -0,0 +1,319 @@
+package gsmake
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSharedTaskCompletion(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	var (
+		generated int32
+		started   = make(chan struct{})
+		errs      = make(chan error)
+	)
+
+	runner.Task(&TaskCmd{Name: "gen", Project: "proto", F: func(*Runner, ...string) error {
+
+		close(started)
+
+		time.Sleep(100 * time.Millisecond)
+
+		atomic.StoreInt32(&generated, 1)
+
+		return nil
+	}})
+
+	runner.Task(&TaskCmd{Name: "gen", Project: "golang", F: func(*Runner, ...string) error {
+		return nil
+	}})
+
+	runner.state = newRunState()
+
+	go func() {
+		errs <- runner.tasks["gen"].invoke(runner, "")
+	}()
+
+	<-started
+
+	// the proto#gen subgroup shares the task which is running by the gen group
+	subgroup, _ := runner.lookup("proto", "gen")
+
+	if err := subgroup.invoke(runner, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if atomic.LoadInt32(&generated) != 1 {
+		t.Fatal("expect subgroup finished after the shared task finished")
+	}
+
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJobsSerial(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	ran := false
+
+	runner.Task(&TaskCmd{Name: "a", F: func(*Runner, ...string) error {
+		ran = true
+		return nil
+	}})
+
+	runner.Jobs(0)
+
+	if err := runner.Run("a"); err != nil || !ran {
+		t.Fatalf("expect task run serially, got %v %v", ran, err)
+	}
+}
+
+func TestParallelJobs(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	var (
+		started sync.WaitGroup
+		both    = make(chan struct{})
+	)
+
+	started.Add(2)
+
+	go func() {
+		started.Wait()
+		close(both)
+	}()
+
+	// the tasks only pass if they are running at the same time
+	for _, name := range []string{"a", "b"} {
+		runner.Task(&TaskCmd{Name: name, F: func(*Runner, ...string) error {
+
+			started.Done()
+
+			select {
+			case <-both:
+				return nil
+			case <-time.After(time.Second):
+				return errors.New("tasks are not running concurrently")
+			}
+		}})
+	}
+
+	runner.Task(&TaskCmd{Name: "all", Prev: []string{"a", "b"}, F: func(*Runner, ...string) error { return nil }})
+
+	runner.Jobs(2)
+
+	if err := runner.Run("all"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExclusiveTask(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	var running, overlapped int32
+
+	f := func(exclusive bool) TaskF {
+		return func(*Runner, ...string) error {
+
+			n := atomic.AddInt32(&running, 1)
+
+			defer atomic.AddInt32(&running, -1)
+
+			if exclusive && n != 1 {
+				atomic.StoreInt32(&overlapped, 1)
+			}
+
+			time.Sleep(20 * time.Millisecond)
+
+			if exclusive && atomic.LoadInt32(&running) != 1 {
+				atomic.StoreInt32(&overlapped, 1)
+			}
+
+			return nil
+		}
+	}
+
+	runner.Task(&TaskCmd{Name: "a", F: f(false)})
+	runner.Task(&TaskCmd{Name: "x", F: f(true), Exclusive: true})
+	runner.Task(&TaskCmd{Name: "b", F: f(false)})
+	runner.Task(&TaskCmd{Name: "c", F: f(false)})
+
+	runner.Task(&TaskCmd{Name: "all", Prev: []string{"a", "x", "b", "c"}, F: func(*Runner, ...string) error { return nil }})
+
+	runner.Jobs(4)
+
+	if err := runner.Run("all"); err != nil {
+		t.Fatal(err)
+	}
+
+	if overlapped != 0 {
+		t.Fatal("exclusive task runs with other tasks concurrently")
+	}
+}
+
+func TestFailureWhileRunning(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	var slowFinished, nextRan int32
+
+	runner.Task(&TaskCmd{Name: "fail", F: func(*Runner, ...string) error {
+		return errors.New("fail task error")
+	}})
+
+	runner.Task(&TaskCmd{Name: "slow", F: func(*Runner, ...string) error {
+		time.Sleep(100 * time.Millisecond)
+		atomic.StoreInt32(&slowFinished, 1)
+		return nil
+	}})
+
+	runner.Task(&TaskCmd{Name: "next", Prev: []string{"slow"}, F: func(*Runner, ...string) error {
+		atomic.StoreInt32(&nextRan, 1)
+		return nil
+	}})
+
+	runner.Task(&TaskCmd{Name: "all", Prev: []string{"fail", "slow", "next"}, F: func(*Runner, ...string) error { return nil }})
+
+	runner.Jobs(2)
+
+	err := runner.Run("all")
+
+	if err == nil || !strings.Contains(err.Error(), "fail task error") {
+		t.Fatalf("expect fail task error, got %v", err)
+	}
+
+	// the running task is waited, the tasks not started are skipped after failure
+	if slowFinished != 1 || nextRan != 0 {
+		t.Fatalf("expect running task finished and next task skipped, got %d %d", slowFinished, nextRan)
+	}
+}
+
+func TestUnresolvedDependency(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	runner.Task(&TaskCmd{Name: "a", F: func(*Runner, ...string) error { return nil }})
+	runner.Task(&TaskCmd{Name: "b", F: func(*Runner, ...string) error { return nil }})
+
+	runner.state = newRunState()
+
+	// the invocation waits for an invocation never scheduled
+	item := &invocation{group: runner.tasks["b"], after: []*invocation{{group: runner.tasks["a"]}}}
+
+	if err := newScheduler(runner, []*invocation{item}).run(); err == nil {
+		t.Fatal("expect unresolved dependency error")
+	}
+}
+
+func TestFinalizer(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	var cleanups int
+
+	runner.Task(&TaskCmd{Name: "prepare", F: func(*Runner, ...string) error {
+		return errors.New("prepare error")
+	}})
+
+	runner.Task(&TaskCmd{Name: "build", FinalizedBy: []string{"cleanup"}, F: func(*Runner, ...string) error {
+		return errors.New("build error")
+	}})
+
+	runner.Task(&TaskCmd{Name: "deploy", Prev: []string{"prepare"}, FinalizedBy: []string{"cleanup"}, F: func(*Runner, ...string) error {
+		return nil
+	}})
+
+	runner.Task(&TaskCmd{Name: "cleanup", F: func(*Runner, ...string) error {
+		cleanups++
+		return nil
+	}})
+
+	// the finalizer runs after the finalized task failed
+	if err := runner.Run("build"); err == nil || !strings.Contains(err.Error(), "build error") {
+		t.Fatalf("expect build error, got %v", err)
+	}
+
+	if cleanups != 1 {
+		t.Fatalf("expect finalizer runs after failed task, got %d runs", cleanups)
+	}
+
+	// the finalizer is skipped if the finalized task never ran
+	if err := runner.Run("deploy"); err == nil || !strings.Contains(err.Error(), "prepare error") {
+		t.Fatalf("expect prepare error, got %v", err)
+	}
+
+	if cleanups != 1 {
+		t.Fatalf("expect finalizer skipped, got %d runs", cleanups)
+	}
+}
+
+func TestAlwaysTask(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	var reported, next bool
+
+	runner.Task(&TaskCmd{Name: "test", F: func(*Runner, ...string) error {
+		return errors.New("test error")
+	}})
+
+	runner.Task(&TaskCmd{Name: "report", Prev: []string{"test"}, Always: true, F: func(*Runner, ...string) error {
+		reported = true
+		return nil
+	}})
+
+	runner.Task(&TaskCmd{Name: "publish", Prev: []string{"report"}, F: func(*Runner, ...string) error {
+		next = true
+		return nil
+	}})
+
+	if err := runner.Run("publish"); err == nil || !strings.Contains(err.Error(), "test error") {
+		t.Fatalf("expect test error, got %v", err)
+	}
+
+	if !reported || next {
+		t.Fatalf("expect only the always task runs after failure, got report %v publish %v", reported, next)
+	}
+}
+
+func TestContinueOnError(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	var ran bool
+
+	runner.Task(&TaskCmd{Name: "a", F: func(*Runner, ...string) error {
+		return errors.New("a error")
+	}})
+
+	runner.Task(&TaskCmd{Name: "b", F: func(*Runner, ...string) error {
+		return errors.New("b error")
+	}})
+
+	runner.Task(&TaskCmd{Name: "c", F: func(*Runner, ...string) error {
+		ran = true
+		return nil
+	}})
+
+	runner.Task(&TaskCmd{Name: "all", Prev: []string{"a", "b", "c"}, F: func(*Runner, ...string) error { return nil }})
+
+	runner.ContinueOnError(true)
+
+	if err := runner.Run("all"); err == nil || !strings.Contains(err.Error(), "2 tasks failed") {
+		t.Fatalf("expect 2 tasks failed, got %v", err)
+	}
+
+	if !ran {
+		t.Fatal("expect independent task runs after failure")
+	}
+}
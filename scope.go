@@ -0,0 +1,188 @@
+package gsmake
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gsdocker/gserrors"
+	"github.com/gsmake/gsmake/property"
+)
+
+// PropertyScopes the property declares the package's scopes, the item syntax is scope[:parent|parent...],
+// selecting a scope also selects the tasks of its parent scopes
+const PropertyScopes = "gsmake.declare.scopes"
+
+// Errors .
+var (
+	ErrScope = errors.New("scope error")
+)
+
+// scopeSelector the parsed domain selector of [selector:]task syntax,
+// e.g: golang, golang|proto, * and !test
+type scopeSelector struct {
+	source  string              // selector string
+	include []string            // selected scopes
+	exclude []string            // excluded scopes
+	any     bool                // select all scopes
+	parents map[string][]string // declared scope parents
+}
+
+// loadScopes load declared scopes inheritance of the processing package
+func loadScopes(pkg *Package) (map[string][]string, error) {
+
+	var declared []string
+
+	if err := pkg.Properties.Query(PropertyScopes, &declared); err != nil {
+
+		if property.NotFound(err) {
+			return nil, nil
+		}
+
+		return nil, gserrors.Newf(err, "invalid property %s", PropertyScopes)
+	}
+
+	parents := make(map[string][]string)
+
+	for _, item := range declared {
+
+		tokens := strings.SplitN(item, ":", 2)
+
+		if tokens[0] == "" {
+			return nil, gserrors.Newf(ErrScope, "invalid declared scope :%s", item)
+		}
+
+		if len(tokens) == 2 {
+			parents[tokens[0]] = append(parents[tokens[0]], strings.Split(tokens[1], "|")...)
+		}
+	}
+
+	return parents, nil
+}
+
+// selectScope parse domain selector, the empty selector only selects the tasks without scope
+func (runner *Runner) selectScope(source string) (*scopeSelector, error) {
+
+	selector := &scopeSelector{
+		source:  source,
+		parents: runner.scopes,
+	}
+
+	if source == "" {
+		return selector, nil
+	}
+
+	for _, term := range strings.Split(source, "|") {
+
+		switch {
+		case term == "*":
+			selector.any = true
+		case strings.HasPrefix(term, "!") && term != "!" && term != "!*":
+			selector.exclude = append(selector.exclude, term[1:])
+		case term != "" && !strings.ContainsAny(term, "!*"):
+			selector.include = append(selector.include, term)
+		default:
+			return nil, gserrors.Newf(ErrScope, "invalid domain selector :%s\n\tthe syntax is domain[|domain...], * or !domain", source)
+		}
+	}
+
+	// the selector only contains negation selects all the other scopes
+	if len(selector.include) == 0 {
+		selector.any = true
+	}
+
+	return selector, nil
+}
+
+// inherits check if scope is the domain itself or the ancestor of the domain
+func (selector *scopeSelector) inherits(domain, scope string) bool {
+
+	visited := make(map[string]bool)
+
+	var visit func(domain string) bool
+
+	visit = func(domain string) bool {
+
+		if domain == scope {
+			return true
+		}
+
+		if visited[domain] {
+			return false
+		}
+
+		visited[domain] = true
+
+		for _, parent := range selector.parents[domain] {
+			if visit(parent) {
+				return true
+			}
+		}
+
+		return false
+	}
+
+	return visit(domain)
+}
+
+// match check if task is selected, returns the domain the task runs in,
+// or the reason why the task is skipped
+func (selector *scopeSelector) match(task *TaskCmd) (domain string, reason string) {
+
+	scopes := strings.Split(task.Scope, "|")
+
+	for _, scope := range scopes {
+		if scope == "" || scope == "all" {
+			if len(selector.include) == 1 {
+				return selector.include[0], ""
+			}
+
+			return "", ""
+		}
+	}
+
+	if selector.source == "" {
+		return "", fmt.Sprintf("scope %s is not selected, no domain selected", task.Scope)
+	}
+
+	for _, scope := range scopes {
+
+		excluded := ""
+
+		for _, name := range selector.exclude {
+			if selector.inherits(scope, name) {
+				excluded = name
+				break
+			}
+		}
+
+		if excluded != "" {
+
+			if reason == "" {
+				if excluded == scope {
+					reason = fmt.Sprintf("scope %s is excluded by !%s", task.Scope, excluded)
+				} else {
+					reason = fmt.Sprintf("scope %s is excluded by !%s, %s inherits %s", task.Scope, excluded, scope, excluded)
+				}
+			}
+
+			continue
+		}
+
+		for _, name := range selector.include {
+			if selector.inherits(name, scope) {
+				return name, ""
+			}
+		}
+
+		if selector.any {
+			return scope, ""
+		}
+	}
+
+	if reason == "" {
+		reason = fmt.Sprintf("scope %s is not selected by %s", task.Scope, selector.source)
+	}
+
+	return "", reason
+}
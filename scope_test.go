@@ -0,0 +1,139 @@
+package gsmake
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gsmake/gsmake/property"
+)
+
+func TestLoadScopes(t *testing.T) {
+
+	pkg := &Package{Properties: property.Properties{}}
+
+	if parents, err := loadScopes(pkg); err != nil || parents != nil {
+		t.Fatalf("expect no declared scopes, got %v %v", parents, err)
+	}
+
+	pkg.Properties[PropertyScopes] = []string{"task", "golang", "gotest:golang", "e2e:gotest|docker"}
+
+	parents, err := loadScopes(pkg)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string][]string{
+		"gotest": {"golang"},
+		"e2e":    {"gotest", "docker"},
+	}
+
+	if !reflect.DeepEqual(parents, expect) {
+		t.Fatalf("expect scope parents %v, got %v", expect, parents)
+	}
+
+	runner := NewRunner("", "")
+
+	runner.scopes = parents
+
+	selector, err := runner.selectScope("e2e")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if domain, reason := selector.match(&TaskCmd{Scope: "golang"}); reason != "" || domain != "e2e" {
+		t.Fatalf("expect e2e inherits golang tasks, got %s %s", domain, reason)
+	}
+
+	for _, invalid := range []interface{}{"golang", []string{":golang"}} {
+
+		pkg.Properties[PropertyScopes] = invalid
+
+		if _, err := loadScopes(pkg); err == nil {
+			t.Fatalf("expect invalid declared scopes :%v", invalid)
+		}
+	}
+}
+
+func TestSelectorTargets(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	executed := 0
+
+	runner.Task(&TaskCmd{Name: "build", Project: "proto", Scope: "proto", F: func(*Runner, ...string) error {
+		executed++
+		return nil
+	}})
+
+	// the contribution skipped by the first selector runs for the second one
+	if err := runner.RunTargets(Target{Name: "!proto:build"}, Target{Name: "golang|proto:build"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if executed != 1 {
+		t.Fatalf("expect proto build executed once, got %d", executed)
+	}
+
+	var buff bytes.Buffer
+
+	if err := runner.PrintTasks(&buff, ListFilter{Domain: "golang|"}, "text"); err == nil {
+		t.Fatal("expect invalid domain filter error")
+	}
+}
+
+func TestScopeSelector(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	runner.scopes = map[string][]string{"gotest": {"golang"}}
+
+	tasks := []*TaskCmd{
+		{Project: "all"},
+		{Project: "golang", Scope: "golang"},
+		{Project: "proto", Scope: "proto"},
+		{Project: "gotest", Scope: "gotest"},
+		{Project: "test", Scope: "test|golang"},
+	}
+
+	cases := map[string]string{
+		"":             "all",
+		"golang":       "all golang test",
+		"golang|proto": "all golang proto test",
+		"*":            "all golang proto gotest test",
+		"!test":        "all golang proto gotest test",
+		"!golang":      "all proto test",
+		"gotest":       "all golang gotest test",
+		"*|!gotest":    "all golang proto test",
+	}
+
+	for source, expect := range cases {
+
+		selector, err := runner.selectScope(source)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+
+		for _, task := range tasks {
+			if _, reason := selector.match(task); reason == "" {
+				names = append(names, task.Project)
+			}
+		}
+
+		if got := strings.Join(names, " "); got != expect {
+			t.Fatalf("selector %s expect tasks %s, got %s", source, expect, got)
+		}
+	}
+
+	for _, source := range []string{"golang|", "!", "!*", "go*"} {
+		if _, err := runner.selectScope(source); err == nil {
+			t.Fatalf("expect invalid selector :%s", source)
+		}
+	}
+}
@@ -0,0 +1,232 @@
+package gsmake
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gsdocker/gserrors"
+)
+
+// Errors .
+var (
+	ErrValue = errors.New("task value error")
+)
+
+// the value key of task's declared output files
+const (
+	KeyOutputs = "outputs"
+)
+
+// taskValues the values stored by one task, the values are json encoded so they can be persisted with
+// task fingerprint and cache
+type taskValues map[string]json.RawMessage
+
+// Set store value of current task for the downstream tasks of this run, the value must be json serializable
+func (runner *Runner) Set(key string, value interface{}) error {
+
+	if runner.current == nil || runner.state == nil {
+		return gserrors.Newf(ErrValue, "set value %s outside task", key)
+	}
+
+	if key == "" || strings.Contains(key, "/") {
+		return gserrors.Newf(ErrValue, "invalid value key :%s", key)
+	}
+
+	content, err := json.Marshal(value)
+
+	if err != nil {
+		return gserrors.Newf(err, "marshal value %s of task %s error", key, runner.current.Name)
+	}
+
+	runner.state.Lock()
+	defer runner.state.Unlock()
+
+	id := taskID(runner.current)
+
+	values, ok := runner.state.values[id]
+
+	if !ok {
+		values = make(taskValues)
+		runner.state.values[id] = values
+	}
+
+	values[key] = content
+
+	return nil
+}
+
+// Get get value stored by task into value, the key syntax is [[package#]task/]key and the default task is current task,
+// the declared outputs of task are stored as task/outputs which is the full paths of output files.
+// Without package the current task's own value is preferred, the value stored by the other packages' contributions
+// to the same task must be unique, except the outputs which are merged
+func (runner *Runner) Get(key string, value interface{}) error {
+
+	if runner.state == nil {
+		return gserrors.Newf(ErrValue, "get value %s outside run", key)
+	}
+
+	name := ""
+
+	if runner.current != nil {
+		name = runner.current.Name
+	}
+
+	if index := strings.LastIndex(key, "/"); index != -1 {
+		name, key = key[:index], key[index+1:]
+	}
+
+	content, err := runner.lookupValue(name, key)
+
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(content, value); err != nil {
+		return gserrors.Newf(err, "unmarshal value %s of task %s error", key, name)
+	}
+
+	return nil
+}
+
+// lookupValue get the json encoded value of [package#]task
+func (runner *Runner) lookupValue(name, key string) (json.RawMessage, error) {
+
+	runner.state.Lock()
+	defer runner.state.Unlock()
+
+	pkg, task := splitTaskPackage(name)
+
+	if pkg != "" {
+
+		content, ok := runner.state.values[name][key]
+
+		if !ok {
+			return nil, gserrors.Newf(ErrValue, "value %s of task %s not found", key, name)
+		}
+
+		return content, nil
+	}
+
+	if runner.current != nil && runner.current.Name == task {
+		if content, ok := runner.state.values[taskID(runner.current)][key]; ok {
+			return content, nil
+		}
+	}
+
+	var ids []string
+
+	for id, values := range runner.state.values {
+		if _, name := splitTaskPackage(id); name == task {
+			if _, ok := values[key]; ok {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	sort.Strings(ids)
+
+	switch {
+	case len(ids) == 0:
+		return nil, gserrors.Newf(ErrValue, "value %s of task %s not found", key, task)
+	case len(ids) == 1:
+		return runner.state.values[ids[0]][key], nil
+	case key == KeyOutputs:
+		return runner.state.outputs(ids)
+	}
+
+	return nil, gserrors.Newf(ErrValue, "value %s of task %s is ambiguous, it's stored by %s", key, task, strings.Join(ids, ", "))
+}
+
+// outputs merge the published outputs of task contributions
+func (state *runState) outputs(ids []string) (json.RawMessage, error) {
+
+	var result []string
+
+	for _, id := range ids {
+
+		var paths []string
+
+		if err := json.Unmarshal(state.values[id][KeyOutputs], &paths); err != nil {
+			return nil, gserrors.Newf(err, "unmarshal value %s of task %s error", KeyOutputs, id)
+		}
+
+		result = append(result, paths...)
+	}
+
+	content, err := json.Marshal(result)
+
+	if err != nil {
+		return nil, gserrors.Newf(err, "marshal value %s error", KeyOutputs)
+	}
+
+	return content, nil
+}
+
+// taskID get the values index of task contribution
+func taskID(task *TaskCmd) string {
+	return task.Project + "#" + task.Name
+}
+
+// dump get the persistable values of task
+func (state *runState) dump(task *TaskCmd) taskValues {
+	state.Lock()
+	defer state.Unlock()
+
+	values := make(taskValues)
+
+	for key, content := range state.values[taskID(task)] {
+		if key != KeyOutputs {
+			values[key] = content
+		}
+	}
+
+	return values
+}
+
+// load load the persisted values of task skipped by up-to-date checking or restored from cache
+func (state *runState) load(task *TaskCmd, values taskValues) {
+	state.Lock()
+	defer state.Unlock()
+
+	if len(values) == 0 {
+		return
+	}
+
+	id := taskID(task)
+
+	current, ok := state.values[id]
+
+	if !ok {
+		current = make(taskValues)
+		state.values[id] = current
+	}
+
+	for key, content := range values {
+		current[key] = content
+	}
+}
+
+// publish store the full paths of task's declared output files
+func (runner *Runner) publish(task *TaskCmd) error {
+
+	if len(task.Outputs) == 0 {
+		return nil
+	}
+
+	files, err := globfiles(runner.targetpath, task.Outputs)
+
+	if err != nil {
+		return err
+	}
+
+	var paths []string
+
+	for _, file := range files {
+		paths = append(paths, filepath.Join(runner.targetpath, filepath.FromSlash(file)))
+	}
+
+	return runner.fork(task).Set(KeyOutputs, paths)
+}
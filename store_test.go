@@ -0,0 +1,68 @@
+package gsmake
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTaskValues(t *testing.T) {
+
+	runner := &Runner{state: newRunState()}
+
+	build1 := &TaskCmd{Name: "build", Project: "github.com/gsmake/a"}
+	build2 := &TaskCmd{Name: "build", Project: "github.com/gsmake/b"}
+	test := &TaskCmd{Name: "test", Project: "github.com/gsmake/a"}
+
+	if err := runner.Set("version", "v1"); err == nil {
+		t.Fatal("expect set value outside task error")
+	}
+
+	for task, values := range map[*TaskCmd][]interface{}{
+		build1: {"v1", []string{"a.out"}},
+		build2: {"v2", []string{"b.out"}},
+	} {
+		if err := runner.fork(task).Set("version", values[0]); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := runner.fork(task).Set(KeyOutputs, values[1]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var version string
+
+	// the contributions of the same task never overwrite each other
+	if err := runner.fork(build2).Get("version", &version); err != nil || version != "v2" {
+		t.Fatalf("expect own value v2, got %s %v", version, err)
+	}
+
+	if err := runner.fork(test).Get("github.com/gsmake/a#build/version", &version); err != nil || version != "v1" {
+		t.Fatalf("expect value v1, got %s %v", version, err)
+	}
+
+	if err := runner.fork(test).Get("build/version", &version); err == nil {
+		t.Fatal("expect ambiguous value error")
+	}
+
+	var outputs []string
+
+	if err := runner.fork(test).Get("build/outputs", &outputs); err != nil || !reflect.DeepEqual(outputs, []string{"a.out", "b.out"}) {
+		t.Fatalf("expect merged outputs, got %v %v", outputs, err)
+	}
+
+	// only the contribution's own values are persisted, the outputs are published again after loading
+	values := runner.state.dump(build1)
+
+	if len(values) != 1 || string(values["version"]) != `"v1"` {
+		t.Fatalf("unexpected persisted values :%v", values)
+	}
+
+	loaded := &Runner{state: newRunState()}
+
+	loaded.state.load(build1, values)
+
+	if err := loaded.fork(test).Get("build/version", &version); err != nil || version != "v1" {
+		t.Fatalf("expect loaded value v1, got %s %v", version, err)
+	}
+}
@@ -0,0 +1,304 @@
+package gsmake
+
+import (
+	"strings"
+
+	"github.com/gsdocker/gserrors"
+)
+
+// Target the task target of one run
+type Target struct {
+	Name string   // task name, the syntax is [domain:][package#]task
+	Args []string // task args
+}
+
+func (target Target) String() string {
+
+	if len(target.Args) == 0 {
+		return target.Name
+	}
+
+	return target.Name + "[" + strings.Join(target.Args, ",") + "]"
+}
+
+// invocation the task group invocation of one run
+type invocation struct {
+	group     *taskGroup    // invoked task group
+	domain    string        // selected domain
+	args      []string      // task args
+	after     []*invocation // the invocations must finish before this one, besides prev tasks
+	finalizes []*invocation // the finalized invocations, this one runs if any of them executed
+}
+
+// parseBracket parse task[arg,arg] syntax
+func parseBracket(word string) (string, []string, bool) {
+
+	index := strings.Index(word, "[")
+
+	if index <= 0 || !strings.HasSuffix(word, "]") {
+		return "", nil, false
+	}
+
+	args := word[index+1 : len(word)-1]
+
+	if args == "" {
+		return word[:index], nil, true
+	}
+
+	return word[:index], strings.Split(args, ","), true
+}
+
+// known check if name is a registered task
+func (runner *Runner) known(name string) bool {
+
+	_, pkg, name := runner.parseTaskName(name)
+
+	_, ok := runner.lookup(pkg, name)
+
+	return ok
+}
+
+// varargs check if the task consumes all following command line words as args
+func (runner *Runner) varargs(name string) bool {
+
+	_, pkg, name := runner.parseTaskName(name)
+
+	if group, ok := runner.lookup(pkg, name); ok {
+		for _, task := range group.group {
+			if task.VarArgs {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// override parse --task.arg=value word, the arg -arg=value is passed to the task wherever it runs in the chain
+func (runner *Runner) override(word string) bool {
+
+	if !strings.HasPrefix(word, "--") {
+		return false
+	}
+
+	word = word[2:]
+
+	key := word
+
+	if index := strings.Index(word, "="); index != -1 {
+		key = word[:index]
+	}
+
+	// the task name may contain '.', use the longest known task name
+	for index := strings.LastIndex(key, "."); index > 0; index = strings.LastIndex(key[:index], ".") {
+
+		_, pkg, name := runner.parseTaskName(key[:index])
+
+		if group, ok := runner.lookup(pkg, name); ok && index+1 < len(key) {
+
+			runner.overrides[group] = append(runner.overrides[group], "-"+word[index+1:])
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// ParseTargets parse command line words into targets,
+// the words are task names until a word which is not a known task or a varargs task, that word and the rest are args of last task;
+// use "--" to start next task after args, or use task[arg,arg] syntax;
+// the --task.arg=value words are not args, they pass -arg=value to the task even if it runs as prerequisite
+func (runner *Runner) ParseTargets(words []string) []Target {
+
+	var (
+		targets []Target
+		argmode = false
+		varargs = false
+		newtask = true
+	)
+
+	for _, word := range words {
+
+		if word == "--" {
+			argmode = false
+			varargs = false
+			newtask = true
+			continue
+		}
+
+		if !varargs && runner.override(word) {
+			continue
+		}
+
+		if !argmode {
+
+			if name, args, ok := parseBracket(word); ok && runner.known(name) {
+				targets = append(targets, Target{Name: name, Args: args})
+				newtask = false
+				continue
+			}
+
+			if newtask || runner.known(word) {
+				targets = append(targets, Target{Name: word})
+				newtask = false
+				argmode = runner.varargs(word)
+				varargs = argmode
+				continue
+			}
+
+			argmode = true
+		}
+
+		last := &targets[len(targets)-1]
+
+		last.Args = append(last.Args, word)
+	}
+
+	return targets
+}
+
+// invocationKey the task group invoked in selected domain
+type invocationKey struct {
+	group  *taskGroup // task group
+	domain string     // selected domain
+}
+
+// schedule get the union of targets' topo sorted task groups, the shared groups are invoked once for every selected domain,
+// the groups introduced by a target run after the previous target;
+// target args are passed to the target only, the prerequisites get their overrides
+func (runner *Runner) schedule(targets []Target) ([]*invocation, error) {
+
+	var (
+		result []*invocation
+		seen   = make(map[invocationKey]*invocation)
+		last   *invocation
+	)
+
+	for _, target := range targets {
+
+		domain, groups, err := runner.resolve(target.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for i, group := range groups {
+
+			istarget := i == len(groups)-1
+
+			key := invocationKey{group: group, domain: domain}
+
+			if item, ok := seen[key]; ok {
+
+				// the prerequisite of previous target is requested as target
+				if istarget {
+					item.args = runner.args(group, target.Args)
+				}
+
+				continue
+			}
+
+			item := &invocation{
+				group:  group,
+				domain: domain,
+				args:   runner.args(group, nil),
+			}
+
+			if istarget {
+				item.args = runner.args(group, target.Args)
+			}
+
+			seen[key] = item
+
+			if last != nil {
+				item.after = append(item.after, last)
+			}
+
+			result = append(result, item)
+		}
+
+		if len(groups) > 0 {
+			last = seen[invocationKey{group: groups[len(groups)-1], domain: domain}]
+		}
+	}
+
+	return runner.finalize(result)
+}
+
+// args get the invocation args of group, the overrides come before target args
+func (runner *Runner) args(group *taskGroup, args []string) []string {
+	return append(append([]string(nil), runner.overrides[group]...), args...)
+}
+
+// finalize insert the finalizer groups right after the finalized groups,
+// the finalizer group already scheduled by targets is not moved
+func (runner *Runner) finalize(items []*invocation) ([]*invocation, error) {
+
+	var (
+		result []*invocation
+		index  = make(map[invocationKey]*invocation)
+	)
+
+	for _, item := range items {
+		index[invocationKey{group: item.group, domain: item.domain}] = item
+	}
+
+	var insert func(item *invocation) error
+
+	insert = func(item *invocation) error {
+
+		result = append(result, item)
+
+		for _, task := range item.group.group {
+
+			for _, name := range task.FinalizedBy {
+
+				domain, groups, err := runner.resolve(name)
+
+				if err != nil {
+					return gserrors.Newf(err, "resolve finalizer of task %s:%s error", task.Project, task.Name)
+				}
+
+				if domain == "" {
+					domain = item.domain
+				}
+
+				for i, group := range groups {
+
+					key := invocationKey{group: group, domain: domain}
+
+					if _, ok := index[key]; ok {
+						continue
+					}
+
+					finalizer := &invocation{
+						group:  group,
+						domain: domain,
+						args:   runner.args(group, nil),
+					}
+
+					if i == len(groups)-1 {
+						finalizer.finalizes = append(finalizer.finalizes, item)
+					}
+
+					index[key] = finalizer
+
+					if err := insert(finalizer); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		return nil
+	}
+
+	for _, item := range items {
+		if err := insert(item); err != nil {
+			return nil, err
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,113 @@
+package gsmake
+
+import (
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestScheduleDomains(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	var executed []string
+
+	for _, project := range []string{"golang", "proto", "app"} {
+
+		scope := project
+
+		if project == "app" {
+			scope = ""
+		}
+
+		runner.Task(&TaskCmd{Name: "build", Project: project, Scope: scope, F: func(runner *Runner, args ...string) error {
+			executed = append(executed, runner.Current().Project+"@"+runner.Domain())
+			return nil
+		}})
+	}
+
+	targets := []Target{{Name: "golang:build"}, {Name: "proto:build"}}
+
+	items, err := runner.schedule(targets)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(items) != 2 || items[0].domain != "golang" || items[1].domain != "proto" {
+		t.Fatalf("expect build invoked for golang and proto domains, got %d invocations", len(items))
+	}
+
+	if err := runner.RunTargets(targets...); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(executed)
+
+	// the task skipped in golang domain still runs for proto domain
+	if got := strings.Join(executed, " "); got != "app@golang app@proto golang@golang proto@proto" {
+		t.Fatalf("unexpected executed tasks :%s", got)
+	}
+}
+
+func TestParseTargets(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	for _, name := range []string{"clean", "build", "test", "create", "plan"} {
+		runner.Task(&TaskCmd{Name: name, VarArgs: name == "plan"})
+	}
+
+	cases := map[string][]string{
+		"clean build test":             {"clean", "build", "test"},
+		"create -o x pkg:arch":         {"create[-o,x,pkg:arch]"},
+		"create -o x build":            {"create[-o,x,build]"},
+		"create -o x -- build -race":   {"create[-o,x]", "build[-race]"},
+		"build[-race,-v] test[-short]": {"build[-race,-v]", "test[-short]"},
+		"plan build test":              {"plan[build,test]"},
+	}
+
+	for words, expect := range cases {
+
+		targets := runner.ParseTargets(strings.Fields(words))
+
+		var result []string
+
+		for _, target := range targets {
+			result = append(result, target.String())
+		}
+
+		if strings.Join(result, " ") != strings.Join(expect, " ") {
+			t.Fatalf("parse %s expect %v, got %v", words, expect, result)
+		}
+	}
+}
+
+func TestTaskArgs(t *testing.T) {
+
+	runner := NewRunner("", "")
+
+	runner.Task(&TaskCmd{Name: "setup"})
+	runner.Task(&TaskCmd{Name: "release.notes"})
+	runner.Task(&TaskCmd{Name: "create", Prev: []string{"setup", "release.notes"}, VarArgs: true})
+
+	targets := runner.ParseTargets(strings.Fields("--setup.gopath=/tmp --release.notes.v create -o x pkg:arch"))
+
+	items, err := runner.schedule(targets)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := map[string]string{
+		"setup":         "-gopath=/tmp",
+		"release.notes": "-v",
+		"create":        "-o x pkg:arch",
+	}
+
+	for _, item := range items {
+		if args := strings.Join(item.args, " "); args != expect[item.group.name] {
+			t.Fatalf("task %s expect args %s, got %s", item.group.name, expect[item.group.name], args)
+		}
+	}
+}
@@ -0,0 +1,456 @@
+package gsmake
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gsdocker/gserrors"
+	"github.com/gsdocker/gsos/fs"
+)
+
+// Errors .
+var (
+	ErrCache = errors.New("task cache error")
+)
+
+// environment variable of remote task cache url
+const (
+	EnvCacheURL = "GSMAKE_CACHE_URL"
+)
+
+// the cache archive entry of task stored values, it's not a valid output path
+const valuesEntry = "@values.json"
+
+// CacheBackend the content-addressed task outputs storage
+type CacheBackend interface {
+	fmt.Stringer
+	// Load write the cached archive of key into writer, returns false if cache missed
+	Load(key string, writer io.Writer) (bool, error)
+	// Store store the archive content as key
+	Store(key string, reader io.Reader) error
+}
+
+// FileCache local task cache backend
+type FileCache struct {
+	root string // cache root dir
+}
+
+// NewFileCache create local task cache backend
+func NewFileCache(root string) *FileCache {
+	return &FileCache{root: root}
+}
+
+func (cache *FileCache) String() string {
+	return fmt.Sprintf("file://%s", filepath.ToSlash(cache.root))
+}
+
+func (cache *FileCache) path(key string) string {
+	return filepath.Join(cache.root, key[:2], key+".tar.gz")
+}
+
+// Load implement CacheBackend
+func (cache *FileCache) Load(key string, writer io.Writer) (bool, error) {
+
+	file, err := os.Open(cache.path(key))
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+
+		return false, gserrors.Newf(err, "open cache file error")
+	}
+
+	defer file.Close()
+
+	if _, err := io.Copy(writer, file); err != nil {
+		return false, gserrors.Newf(err, "read cache file error")
+	}
+
+	return true, nil
+}
+
+// Store implement CacheBackend
+func (cache *FileCache) Store(key string, reader io.Reader) error {
+
+	path := cache.path(key)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return gserrors.Newf(err, "create cache dir error\n\t%s", path)
+	}
+
+	tmpfile, err := ioutil.TempFile(filepath.Dir(path), key)
+
+	if err != nil {
+		return gserrors.Newf(err, "create cache file error\n\t%s", path)
+	}
+
+	_, err = io.Copy(tmpfile, reader)
+
+	tmpfile.Close()
+
+	if err != nil {
+		os.Remove(tmpfile.Name())
+		return gserrors.Newf(err, "write cache file error\n\t%s", path)
+	}
+
+	if err := os.Rename(tmpfile.Name(), path); err != nil {
+		os.Remove(tmpfile.Name())
+		return gserrors.Newf(err, "write cache file error\n\t%s", path)
+	}
+
+	return nil
+}
+
+// HTTPCache remote task cache backend, the protocol is GET/PUT {url}/{key}
+type HTTPCache struct {
+	url    string       // remote url
+	client *http.Client // http client
+}
+
+// NewHTTPCache create remote task cache backend
+func NewHTTPCache(url string) *HTTPCache {
+	return &HTTPCache{
+		url:    strings.TrimSuffix(url, "/"),
+		client: http.DefaultClient,
+	}
+}
+
+func (cache *HTTPCache) String() string {
+	return cache.url
+}
+
+// Load implement CacheBackend
+func (cache *HTTPCache) Load(key string, writer io.Writer) (bool, error) {
+
+	resp, err := cache.client.Get(cache.url + "/" + key)
+
+	if err != nil {
+		return false, gserrors.Newf(err, "get remote cache error")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return false, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return false, gserrors.Newf(ErrCache, "get remote cache error :%s", resp.Status)
+	}
+
+	if _, err := io.Copy(writer, resp.Body); err != nil {
+		return false, gserrors.Newf(err, "read remote cache error")
+	}
+
+	return true, nil
+}
+
+// Store implement CacheBackend
+func (cache *HTTPCache) Store(key string, reader io.Reader) error {
+
+	request, err := http.NewRequest("PUT", cache.url+"/"+key, reader)
+
+	if err != nil {
+		return gserrors.Newf(err, "create remote cache request error")
+	}
+
+	resp, err := cache.client.Do(request)
+
+	if err != nil {
+		return gserrors.Newf(err, "put remote cache error")
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return gserrors.Newf(ErrCache, "put remote cache error :%s", resp.Status)
+	}
+
+	return nil
+}
+
+// cacheable only the tasks declare both inputs and outputs are cached
+func (task *TaskCmd) cacheable() bool {
+	return task.Inputs != nil && len(task.Outputs) != 0
+}
+
+// cacheKey calc task cache key from inputs hash and the sources of package which defined the task,
+// the version is not enough because "current" tracks the branch and the root package has no version
+func cacheKey(task *TaskCmd, inputs string) string {
+
+	hash := sha1.Sum([]byte(fmt.Sprintf("%s %s %s\n%s", task.Project, task.Version, task.Digest, inputs)))
+
+	return hex.EncodeToString(hash[:])
+}
+
+// restore restore task outputs from cache backends, returns false if cache missed
+func (runner *Runner) restore(task *TaskCmd, current *fingerprint) (bool, error) {
+
+	if !task.cacheable() || len(runner.caches) == 0 {
+		return false, nil
+	}
+
+	key := cacheKey(task, current.Inputs)
+
+	tmpfile, err := ioutil.TempFile("", "gsmake-cache")
+
+	if err != nil {
+		return false, gserrors.Newf(err, "create cache temp file error")
+	}
+
+	defer func() {
+		tmpfile.Close()
+		os.Remove(tmpfile.Name())
+	}()
+
+	for i, cache := range runner.caches {
+
+		ok, err := cache.Load(key, tmpfile)
+
+		if err != nil {
+			runner.W("load task cache from %s error\n%s", cache, err)
+		}
+
+		if !ok || err != nil {
+
+			if err := resetfile(tmpfile); err != nil {
+				return false, err
+			}
+
+			continue
+		}
+
+		if _, err := tmpfile.Seek(0, 0); err != nil {
+			return false, gserrors.Newf(err, "seek cache temp file error")
+		}
+
+		values, err := untar(tmpfile, runner.targetpath)
+
+		if err != nil {
+			return false, err
+		}
+
+		current.Values = values
+
+		runner.D("restore %s:%s from cache %s :%s", task.Project, task.Name, cache, key)
+
+		// populate the upper cache backends
+		for _, upper := range runner.caches[:i] {
+
+			if _, err := tmpfile.Seek(0, 0); err != nil {
+				return true, nil
+			}
+
+			if err := upper.Store(key, tmpfile); err != nil {
+				runner.W("store task cache to %s error\n%s", upper, err)
+			}
+		}
+
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// save save task outputs into all cache backends
+func (runner *Runner) save(task *TaskCmd, current *fingerprint) error {
+
+	if !task.cacheable() || len(runner.caches) == 0 {
+		return nil
+	}
+
+	key := cacheKey(task, current.Inputs)
+
+	files, err := globfiles(runner.targetpath, task.Outputs)
+
+	if err != nil {
+		return err
+	}
+
+	tmpfile, err := ioutil.TempFile("", "gsmake-cache")
+
+	if err != nil {
+		return gserrors.Newf(err, "create cache temp file error")
+	}
+
+	defer func() {
+		tmpfile.Close()
+		os.Remove(tmpfile.Name())
+	}()
+
+	if err := tarfiles(tmpfile, runner.targetpath, files, current.Values); err != nil {
+		return err
+	}
+
+	for _, cache := range runner.caches {
+
+		if _, err := tmpfile.Seek(0, 0); err != nil {
+			return gserrors.Newf(err, "seek cache temp file error")
+		}
+
+		if err := cache.Store(key, tmpfile); err != nil {
+			runner.W("store task cache to %s error\n%s", cache, err)
+		}
+	}
+
+	return nil
+}
+
+func resetfile(file *os.File) error {
+
+	if err := file.Truncate(0); err != nil {
+		return gserrors.Newf(err, "truncate cache temp file error")
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		return gserrors.Newf(err, "seek cache temp file error")
+	}
+
+	return nil
+}
+
+func tarfiles(writer io.Writer, root string, files []string, values taskValues) error {
+
+	gzipWriter := gzip.NewWriter(writer)
+
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	if len(values) != 0 {
+
+		content, err := json.Marshal(values)
+
+		if err != nil {
+			return gserrors.Newf(err, "marshal task values error")
+		}
+
+		header := &tar.Header{Name: valuesEntry, Mode: 0644, Size: int64(len(content))}
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return gserrors.Newf(err, "write tar header error\n\t%s", valuesEntry)
+		}
+
+		if _, err := tarWriter.Write(content); err != nil {
+			return gserrors.Newf(err, "write tar content error\n\t%s", valuesEntry)
+		}
+	}
+
+	for _, file := range files {
+
+		path := filepath.Join(root, filepath.FromSlash(file))
+
+		info, err := os.Stat(path)
+
+		if err != nil {
+			return gserrors.Newf(err, "stat output file error\n\t%s", path)
+		}
+
+		header, err := tar.FileInfoHeader(info, "")
+
+		if err != nil {
+			return gserrors.Newf(err, "create tar header error\n\t%s", path)
+		}
+
+		header.Name = file
+
+		if err := tarWriter.WriteHeader(header); err != nil {
+			return gserrors.Newf(err, "write tar header error\n\t%s", path)
+		}
+
+		content, err := os.Open(path)
+
+		if err != nil {
+			return gserrors.Newf(err, "open output file error\n\t%s", path)
+		}
+
+		_, err = io.Copy(tarWriter, content)
+
+		content.Close()
+
+		if err != nil {
+			return gserrors.Newf(err, "write tar content error\n\t%s", path)
+		}
+	}
+
+	if err := tarWriter.Close(); err != nil {
+		return gserrors.Newf(err, "close tar writer error")
+	}
+
+	if err := gzipWriter.Close(); err != nil {
+		return gserrors.Newf(err, "close gzip writer error")
+	}
+
+	return nil
+}
+
+// untar extract output files into root, and returns the task stored values
+func untar(reader io.Reader, root string) (taskValues, error) {
+
+	gzipReader, err := gzip.NewReader(reader)
+
+	if err != nil {
+		return nil, gserrors.Newf(err, "open cache archive error")
+	}
+
+	tarReader := tar.NewReader(gzipReader)
+
+	var values taskValues
+
+	for {
+		header, err := tarReader.Next()
+
+		if err == io.EOF {
+			return values, nil
+		}
+
+		if err != nil {
+			return nil, gserrors.Newf(err, "read cache archive error")
+		}
+
+		if header.Name == valuesEntry {
+
+			if err := json.NewDecoder(tarReader).Decode(&values); err != nil {
+				return nil, gserrors.Newf(err, "read task values error")
+			}
+
+			continue
+		}
+
+		name := filepath.FromSlash(header.Name)
+
+		if filepath.IsAbs(name) || strings.HasPrefix(filepath.Clean(name), "..") {
+			return nil, gserrors.Newf(ErrCache, "invalid cache archive entry :%s", header.Name)
+		}
+
+		path := filepath.Join(root, name)
+
+		if err := fs.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, gserrors.Newf(err, "create output dir error\n\t%s", path)
+		}
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, os.FileMode(header.Mode)&os.ModePerm)
+
+		if err != nil {
+			return nil, gserrors.Newf(err, "create output file error\n\t%s", path)
+		}
+
+		_, err = io.Copy(file, tarReader)
+
+		file.Close()
+
+		if err != nil {
+			return nil, gserrors.Newf(err, "write output file error\n\t%s", path)
+		}
+	}
+}
@@ -0,0 +1,340 @@
+package gsmake
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gsmake/gsmake/vfs"
+)
+
+// cacheServer stand-in remote cache server
+type cacheServer struct {
+	sync.Mutex
+	entries map[string][]byte
+}
+
+func (server *cacheServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.Lock()
+	defer server.Unlock()
+
+	switch r.Method {
+	case "GET":
+		content, ok := server.entries[r.URL.Path]
+
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Write(content)
+	case "PUT":
+		content, err := ioutil.ReadAll(r.Body)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		server.entries[r.URL.Path] = content
+	}
+}
+
+func TestHTTPCache(t *testing.T) {
+
+	server := httptest.NewServer(&cacheServer{entries: make(map[string][]byte)})
+
+	defer server.Close()
+
+	root, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, "bin"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, "bin", "app"), []byte("binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var archive bytes.Buffer
+
+	stored := taskValues{"version": []byte(`"v1.0.0"`)}
+
+	if err := tarfiles(&archive, root, []string{"bin/app"}, stored); err != nil {
+		t.Fatal(err)
+	}
+
+	cache := NewHTTPCache(server.URL)
+
+	var buff bytes.Buffer
+
+	if ok, err := cache.Load("0123456789", &buff); err != nil || ok {
+		t.Fatalf("expect cache missed, got %v %v", ok, err)
+	}
+
+	if err := cache.Store("0123456789", bytes.NewReader(archive.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := cache.Load("0123456789", &buff); err != nil || !ok {
+		t.Fatalf("expect cache hit, got %v %v", ok, err)
+	}
+
+	output := filepath.Join(root, "restore")
+
+	values, err := untar(&buff, output)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(values["version"]) != `"v1.0.0"` {
+		t.Fatalf("restore values error :%s", values["version"])
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(output, "bin", "app"))
+
+	if err != nil || string(content) != "binary" {
+		t.Fatalf("restore output error :%s %v", content, err)
+	}
+}
+
+// newTestRunner create started runner for temporary gsmake root and package dirs
+func newTestRunner(t *testing.T, tasks ...*TaskCmd) *Runner {
+
+	root, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(root)
+	})
+
+	target := filepath.Join(root, "target")
+
+	if err := os.MkdirAll(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(target, ".gsmake.json"), []byte(`{"name":"github.com/gsmake/test"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := NewRunner(filepath.Join(root, "root"), target)
+
+	for _, task := range tasks {
+		runner.Task(task)
+	}
+
+	if err := runner.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	return runner
+}
+
+func TestRerunTasks(t *testing.T) {
+
+	executed := 0
+
+	var runner *Runner
+
+	runner = newTestRunner(t, &TaskCmd{
+		Name:    "build",
+		Project: "github.com/gsmake/test",
+		Inputs:  &TaskInputs{Files: []string{"*.go"}},
+		Outputs: []string{"bin/*"},
+		F: func(*Runner, ...string) error {
+			executed++
+
+			if err := os.MkdirAll(filepath.Join(runner.targetpath, "bin"), 0755); err != nil {
+				return err
+			}
+
+			return ioutil.WriteFile(filepath.Join(runner.targetpath, "bin", "app"), []byte("binary"), 0644)
+		},
+	})
+
+	for i := 0; i < 2; i++ {
+		if err := runner.Run("build"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if executed != 1 {
+		t.Fatalf("expect up-to-date task executed once, got %d", executed)
+	}
+
+	// the cached outputs exist, but --rerun-tasks must execute the task
+	runner.RerunTasks(true)
+
+	if err := runner.Run("build"); err != nil {
+		t.Fatal(err)
+	}
+
+	if executed != 2 {
+		t.Fatalf("expect rerun task executed, got %d executions", executed)
+	}
+}
+
+func TestTaskDigestRerun(t *testing.T) {
+
+	executed := 0
+
+	task := &TaskCmd{
+		Name:    "build",
+		Project: "github.com/gsmake/test",
+		Version: "v1.0.0",
+		Digest:  "digest1",
+		Outputs: []string{"bin/*"},
+	}
+
+	runner := newTestRunner(t, task)
+
+	task.F = func(*Runner, ...string) error {
+		executed++
+
+		if err := os.MkdirAll(filepath.Join(runner.targetpath, "bin"), 0755); err != nil {
+			return err
+		}
+
+		return ioutil.WriteFile(filepath.Join(runner.targetpath, "bin", "app"), []byte("binary"), 0644)
+	}
+
+	run := func(expect int) {
+
+		if err := runner.Run("build"); err != nil {
+			t.Fatal(err)
+		}
+
+		if executed != expect {
+			t.Fatalf("expect task executed %d times, got %d", expect, executed)
+		}
+	}
+
+	run(1)
+	run(1)
+
+	// the changed task sources or package version make the outputs out of date
+	task.Digest = "digest2"
+
+	run(2)
+
+	task.Version = "v1.0.1"
+
+	run(3)
+}
+
+func TestSourcesDigest(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	if err := os.MkdirAll(filepath.Join(root, ".gsmake"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(name, content string) {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	digest := func() string {
+
+		digest, err := sourcesDigest(root)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return digest
+	}
+
+	write(".gsmake.json", `{"name":"github.com/gsmake/test"}`)
+	write(".gsmake/build.go", "package tasks\n")
+
+	first := digest()
+
+	// the package sources are not part of the digest
+	write("main.go", "package main\n")
+
+	if digest() != first {
+		t.Fatal("expect digest only depends on task sources")
+	}
+
+	write(".gsmake/build.go", "package tasks\n\n// TaskBuild .\n")
+
+	second := digest()
+
+	if second == first {
+		t.Fatal("expect digest changed after task sources edited")
+	}
+
+	task := &TaskCmd{Name: "build", Project: "github.com/gsmake/test", Version: "current"}
+
+	key := cacheKey(task, "inputs")
+
+	task.Digest = second
+
+	if cacheKey(task, "inputs") == key {
+		t.Fatal("expect cache key changed with package digest")
+	}
+}
+
+func TestRelocatableStateDir(t *testing.T) {
+
+	root, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(root)
+
+	if err := ioutil.WriteFile(filepath.Join(root, vfs.SnapshotIndexer), []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(root, ".gsmake.json"), []byte(`{"name":"github.com/gsmake/test"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := NewRunner(root, root)
+
+	runner.relocatable = true
+
+	if err := runner.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer runner.rootfs.Clear()
+
+	task := &TaskCmd{Name: "build", Project: "github.com/gsmake/test"}
+
+	// the task cache and fingerprints never write into the read-only snapshot
+	for _, path := range []string{runner.caches[0].String(), runner.fingerprintfile(task)} {
+		if strings.Contains(path, filepath.ToSlash(root)) || strings.HasPrefix(path, root) {
+			t.Fatalf("expect state kept out of snapshot %s, got %s", root, path)
+		}
+	}
+}
@@ -0,0 +1,422 @@
+// Package testing the harness for unit-testing gsmake task functions without GSMAKE_HOME,
+// scm remotes and the compiled runner
+package testing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	gotesting "testing"
+
+	"github.com/gsdocker/gserrors"
+	"github.com/gsdocker/gslogger"
+	"github.com/gsdocker/gsos/fs"
+	"github.com/gsmake/gsmake"
+	"github.com/gsmake/gsmake/property"
+)
+
+// Harness run task functions on a runner backed by temporary gsmake root, package and start dirs
+type Harness struct {
+	t        gotesting.TB      // test object
+	dir      string            // the temporary dir holds all the others
+	root     string            // gsmake root path
+	target   string            // processing package path
+	startdir string            // runner start dir
+	pkg      *gsmake.Package   // processing package
+	tasks    []*gsmake.TaskCmd // registered tasks
+	packages map[string]string // fake packages path, indexed by package name
+	runner   *gsmake.Runner    // runner, created by the first run
+	stdout   lockedBuffer      // captured stdout
+	stderr   lockedBuffer      // captured stderr
+	log      *logRecorder      // captured log
+}
+
+// New create test harness, the processing package is named name,
+// all the temporary dirs are removed after the test finished
+func New(t gotesting.TB, name string) *Harness {
+
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatalf("create temp dir error :%s", err)
+	}
+
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	harness := &Harness{
+		t:        t,
+		dir:      dir,
+		root:     filepath.Join(dir, "root"),
+		target:   filepath.Join(dir, "target"),
+		startdir: filepath.Join(dir, "start"),
+		packages: make(map[string]string),
+		pkg: &gsmake.Package{
+			Name:       name,
+			Domain:     gsmake.DomainDefault,
+			Properties: make(property.Properties),
+		},
+	}
+
+	for _, path := range []string{harness.root, harness.target, harness.startdir} {
+		if err := fs.MkdirAll(path, 0755); err != nil {
+			t.Fatalf("create temp dir error :%s", err)
+		}
+	}
+
+	return harness
+}
+
+// Root get the temporary gsmake root path
+func (harness *Harness) Root() string {
+	return harness.root
+}
+
+// Target get the processing package path
+func (harness *Harness) Target() string {
+	return harness.target
+}
+
+// StartDir get the runner start dir
+func (harness *Harness) StartDir() string {
+	return harness.startdir
+}
+
+// Property set the processing package's property, must be called before the first run
+func (harness *Harness) Property(name string, value interface{}) *Harness {
+
+	harness.pkg.Properties[name] = value
+
+	return harness
+}
+
+// Task register task function for the processing package, must be called before the first run
+func (harness *Harness) Task(name string, f gsmake.TaskF) *Harness {
+
+	harness.tasks = append(harness.tasks, &gsmake.TaskCmd{
+		Name:    name,
+		F:       f,
+		Project: harness.pkg.Name,
+	})
+
+	return harness
+}
+
+// TaskCmd register task of any package, e.g: the contributions of imported packages to the same task,
+// must be called before the first run
+func (harness *Harness) TaskCmd(task *gsmake.TaskCmd) *Harness {
+
+	harness.tasks = append(harness.tasks, task)
+
+	return harness
+}
+
+// Package write fake package into temporary dir and redirect the package's current version to it,
+// so mounting the package never touches the scm remotes. The files are indexed by package relative path
+func (harness *Harness) Package(pkg *gsmake.Package, files map[string]string) string {
+
+	harness.t.Helper()
+
+	path := filepath.Join(harness.dir, "packages", filepath.FromSlash(pkg.Name))
+
+	harness.write(path, pkg, files)
+
+	harness.packages[pkg.Name] = path
+
+	if harness.runner != nil {
+		harness.redirect(pkg.Name)
+	}
+
+	return path
+}
+
+// Mount mount fake package into domain
+func (harness *Harness) Mount(domain, name string) string {
+
+	harness.t.Helper()
+
+	rootfs := harness.Runner().RootFS()
+
+	src := fmt.Sprintf("%s://%s?version=current", rootfs.Protocol(host(name)), name)
+
+	if err := rootfs.Mount(src, fmt.Sprintf("gsmake://%s?domain=%s", name, domain)); err != nil {
+		harness.t.Fatalf("mount %s into domain %s error :%s", name, domain, err)
+	}
+
+	path, err := harness.runner.Path(domain, name)
+
+	if err != nil {
+		harness.t.Fatalf("get %s path error :%s", name, err)
+	}
+
+	return path
+}
+
+// Runner get the harness runner, the runner is started by the first call
+func (harness *Harness) Runner() *gsmake.Runner {
+
+	harness.t.Helper()
+
+	if harness.runner != nil {
+		return harness.runner
+	}
+
+	harness.write(harness.target, harness.pkg, nil)
+
+	runner := gsmake.NewRunner(harness.root, harness.target)
+
+	harness.log = &logRecorder{Log: runner.Log}
+
+	runner.Log = harness.log
+
+	runner.StartFrom(harness.startdir)
+
+	runner.Output(&harness.stdout, &harness.stderr)
+
+	for _, task := range harness.tasks {
+		runner.Task(task)
+	}
+
+	if err := runner.Start(); err != nil {
+		harness.t.Fatalf("start runner error :%s", err)
+	}
+
+	harness.runner = runner
+
+	// the processing package is mounted like the loader does
+	if err := runner.RootFS().Mount(fmt.Sprintf("file://%s?version=current", harness.target), fmt.Sprintf("gsmake://%s?domain=task", harness.pkg.Name)); err != nil {
+		harness.t.Fatalf("mount processing package error :%s", err)
+	}
+
+	for name := range harness.packages {
+		harness.redirect(name)
+	}
+
+	return runner
+}
+
+// Run run task with args
+func (harness *Harness) Run(name string, args ...string) error {
+
+	harness.t.Helper()
+
+	return harness.Runner().Run(name, args...)
+}
+
+// MustRun run task with args, the test fails if the task failed
+func (harness *Harness) MustRun(name string, args ...string) {
+
+	harness.t.Helper()
+
+	if err := harness.Run(name, args...); err != nil {
+		harness.t.Fatalf("run task %s error :%s\n\tlog :\n%s", name, err, harness.Logs())
+	}
+}
+
+// MustFail run task with args, the test fails if the task passed or the error message doesn't contain message
+func (harness *Harness) MustFail(name string, message string, args ...string) error {
+
+	harness.t.Helper()
+
+	err := harness.Run(name, args...)
+
+	if err == nil {
+		harness.t.Fatalf("run task %s expect error :%s", name, message)
+	}
+
+	if !strings.Contains(err.Error(), message) {
+		harness.t.Fatalf("run task %s expect error :%s\n\tgot :%s", name, message, err)
+	}
+
+	return err
+}
+
+// Stdout get captured stdout output
+func (harness *Harness) Stdout() string {
+	return harness.stdout.String()
+}
+
+// Stderr get captured stderr output
+func (harness *Harness) Stderr() string {
+	return harness.stderr.String()
+}
+
+// Logs get captured runner log
+func (harness *Harness) Logs() string {
+
+	if harness.log == nil {
+		return ""
+	}
+
+	return harness.log.String()
+}
+
+// ExpectStdout check if captured stdout contains text
+func (harness *Harness) ExpectStdout(text string) {
+
+	harness.t.Helper()
+
+	if output := harness.Stdout(); !strings.Contains(output, text) {
+		harness.t.Fatalf("expect stdout contains :%s\n\tstdout :\n%s", text, output)
+	}
+}
+
+// ExpectLog check if captured log contains text
+func (harness *Harness) ExpectLog(text string) {
+
+	harness.t.Helper()
+
+	if output := harness.Logs(); !strings.Contains(output, text) {
+		harness.t.Fatalf("expect log contains :%s\n\tlog :\n%s", text, output)
+	}
+}
+
+// ExpectFile check if file exists, the relative path is relative to the runner start dir
+func (harness *Harness) ExpectFile(path string) {
+
+	harness.t.Helper()
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(harness.startdir, path)
+	}
+
+	if !fs.Exists(path) {
+		harness.t.Fatalf("expect file exists :%s", path)
+	}
+}
+
+func (harness *Harness) redirect(name string) {
+
+	harness.t.Helper()
+
+	rootfs := harness.runner.RootFS()
+
+	from := fmt.Sprintf("%s://%s?version=current", rootfs.Protocol(host(name)), name)
+
+	if err := rootfs.Redirect(from, fmt.Sprintf("file://%s", harness.packages[name]), true); err != nil {
+		harness.t.Fatalf("redirect fake package error :%s", err)
+	}
+}
+
+func (harness *Harness) write(path string, pkg *gsmake.Package, files map[string]string) {
+
+	harness.t.Helper()
+
+	if err := writepackage(path, pkg, files); err != nil {
+		harness.t.Fatalf("write package %s error :%s", pkg.Name, err)
+	}
+}
+
+func writepackage(path string, pkg *gsmake.Package, files map[string]string) error {
+
+	content, err := json.MarshalIndent(pkg, "", "\t")
+
+	if err != nil {
+		return gserrors.Newf(err, "marshal .gsmake.json error")
+	}
+
+	files = merge(files, ".gsmake.json", string(content))
+
+	for name, content := range files {
+
+		fullpath := filepath.Join(path, filepath.FromSlash(name))
+
+		if err := fs.MkdirAll(filepath.Dir(fullpath), 0755); err != nil {
+			return gserrors.Newf(err, "create dir error\n\t%s", filepath.Dir(fullpath))
+		}
+
+		if err := ioutil.WriteFile(fullpath, []byte(content), 0644); err != nil {
+			return gserrors.Newf(err, "write file error\n\t%s", fullpath)
+		}
+	}
+
+	return nil
+}
+
+func merge(files map[string]string, name, content string) map[string]string {
+
+	result := map[string]string{name: content}
+
+	for k, v := range files {
+		result[k] = v
+	}
+
+	return result
+}
+
+// host get the host part of package name
+func host(name string) string {
+
+	if index := strings.Index(name, "/"); index != -1 {
+		return name[:index]
+	}
+
+	return name
+}
+
+// lockedBuffer buffer can be written by concurrent tasks
+type lockedBuffer struct {
+	sync.Mutex              // buffer locker
+	buff       bytes.Buffer // buffer
+}
+
+func (buff *lockedBuffer) Write(p []byte) (int, error) {
+	buff.Lock()
+	defer buff.Unlock()
+
+	return buff.buff.Write(p)
+}
+
+func (buff *lockedBuffer) String() string {
+	buff.Lock()
+	defer buff.Unlock()
+
+	return buff.buff.String()
+}
+
+// logRecorder record log and forward it to the original log
+type logRecorder struct {
+	gslogger.Log              // original log
+	buff         lockedBuffer // recorded log
+}
+
+func (recorder *logRecorder) record(level, f string, args ...interface{}) {
+	fmt.Fprintf(&recorder.buff, "[%s] %s\n", level, fmt.Sprintf(f, args...))
+}
+
+// D implement gslogger.Log
+func (recorder *logRecorder) D(f string, args ...interface{}) {
+	recorder.record("debug", f, args...)
+	recorder.Log.D(f, args...)
+}
+
+// I implement gslogger.Log
+func (recorder *logRecorder) I(f string, args ...interface{}) {
+	recorder.record("info", f, args...)
+	recorder.Log.I(f, args...)
+}
+
+// W implement gslogger.Log
+func (recorder *logRecorder) W(f string, args ...interface{}) {
+	recorder.record("warn", f, args...)
+	recorder.Log.W(f, args...)
+}
+
+// E implement gslogger.Log
+func (recorder *logRecorder) E(f string, args ...interface{}) {
+	recorder.record("error", f, args...)
+	recorder.Log.E(f, args...)
+}
+
+// String get recorded log
+func (recorder *logRecorder) String() string {
+	return recorder.buff.String()
+}
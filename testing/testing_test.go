@@ -0,0 +1,61 @@
+package testing
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/gsmake/gsmake"
+)
+
+func TestHarnessCapture(t *testing.T) {
+
+	harness := New(t, "github.com/gsmake/hello")
+
+	harness.Task("hello", func(runner *gsmake.Runner, args ...string) error {
+
+		fmt.Fprintf(runner.Stdout(), "hello stdout %v\n", args)
+
+		fmt.Fprintln(runner.Stderr(), "hello stderr")
+
+		runner.I("hello log")
+
+		return nil
+	})
+
+	harness.MustRun("hello", "world")
+
+	harness.ExpectStdout("hello stdout [world]")
+
+	harness.ExpectLog("[info] hello log")
+
+	if stderr := harness.Stderr(); stderr != "hello stderr\n" {
+		t.Fatalf("expect captured stderr, got :%s", stderr)
+	}
+
+	if stdout := harness.Stdout(); stdout != "hello stdout [world]\n" {
+		t.Fatalf("expect stderr not mixed into stdout, got :%s", stdout)
+	}
+}
+
+func TestHarnessPackage(t *testing.T) {
+
+	harness := New(t, "github.com/gsmake/hello")
+
+	// the packages written before and after the runner started are both redirected
+	harness.Package(&gsmake.Package{Name: "github.com/gsmake/before"}, map[string]string{
+		"before.go": "package before\n",
+	})
+
+	harness.Runner()
+
+	harness.Package(&gsmake.Package{Name: "github.com/gsmake/after"}, map[string]string{
+		"src/after.go": "package after\n",
+	})
+
+	harness.ExpectFile(filepath.Join(harness.Mount("golang", "github.com/gsmake/before"), "before.go"))
+
+	harness.ExpectFile(filepath.Join(harness.Mount("golang", "github.com/gsmake/after"), "src", "after.go"))
+
+	harness.ExpectFile(filepath.Join(harness.Mount("golang", "github.com/gsmake/after"), ".gsmake.json"))
+}
@@ -0,0 +1,243 @@
+package gsmake
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gsdocker/gserrors"
+)
+
+// traceEvent the chrome trace event
+type traceEvent struct {
+	Name  string            `json:"name"`           // span name
+	Cat   string            `json:"cat,omitempty"`  // span category
+	Ph    string            `json:"ph"`             // event phase, X complete event, i instant event, M metadata
+	Ts    int64             `json:"ts"`             // start timestamp in microseconds
+	Dur   int64             `json:"dur,omitempty"`  // duration in microseconds
+	Pid   int               `json:"pid"`            // process id
+	Tid   int               `json:"tid"`            // track id
+	Scope string            `json:"s,omitempty"`    // instant event scope
+	Args  map[string]string `json:"args,omitempty"` // span args
+}
+
+// traceSpan the started span
+type traceSpan struct {
+	start time.Time // span start time
+	track int       // span track id
+}
+
+// phaseTracks the first track id of phases, the phases are placed on their own tracks below the task tracks
+const phaseTracks = 1000
+
+// tracks the track pool, the track id is the first track id + index
+type tracks struct {
+	first int    // first track id
+	busy  []bool // busy flag of tracks
+}
+
+// acquire get the lowest free track
+func (pool *tracks) acquire() int {
+
+	for i, busy := range pool.busy {
+		if !busy {
+			pool.busy[i] = true
+			return pool.first + i
+		}
+	}
+
+	pool.busy = append(pool.busy, true)
+
+	return pool.first + len(pool.busy) - 1
+}
+
+func (pool *tracks) release(track int) {
+	pool.busy[track-pool.first] = false
+}
+
+// TraceWriter write build spans as chrome trace events, the trace file is a json array without closing bracket
+// which is accepted by trace viewers, so the cli and runner processes can append spans into the same file;
+// the concurrent spans are placed on separate tracks, the tasks and phases never share tracks
+type TraceWriter struct {
+	sync.Mutex                      // writer locker
+	file       *os.File             // trace file
+	pid        int                  // process id
+	tasks      tracks               // task tracks
+	phases     tracks               // phase tracks
+	spans      map[string]traceSpan // started spans
+}
+
+// OpenTrace open trace file in append mode, returns nil if path is empty
+func OpenTrace(path string, process string) (*TraceWriter, error) {
+
+	if path == "" {
+		return nil, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return nil, gserrors.Newf(err, "open trace file error\n\t%s", path)
+	}
+
+	info, err := file.Stat()
+
+	if err != nil {
+		file.Close()
+		return nil, gserrors.Newf(err, "stat trace file error\n\t%s", path)
+	}
+
+	if info.Size() == 0 {
+		if _, err := file.WriteString("[\n"); err != nil {
+			file.Close()
+			return nil, gserrors.Newf(err, "write trace file error\n\t%s", path)
+		}
+	}
+
+	writer := &TraceWriter{
+		file:   file,
+		pid:    os.Getpid(),
+		tasks:  tracks{first: 1},
+		phases: tracks{first: phaseTracks},
+		spans:  make(map[string]traceSpan),
+	}
+
+	writer.write(&traceEvent{
+		Name: "process_name",
+		Ph:   "M",
+		Pid:  writer.pid,
+		Args: map[string]string{"name": "gsmake " + process},
+	})
+
+	return writer, nil
+}
+
+func (writer *TraceWriter) write(event *traceEvent) {
+
+	content, err := json.Marshal(event)
+
+	if err != nil {
+		return
+	}
+
+	writer.file.Write(append(content, ",\n"...))
+}
+
+// spankey get the span key and category of event, returns empty key if event is not a span
+func spankey(event *Event) (string, string) {
+
+	switch {
+	case strings.HasPrefix(event.Type, "phase."):
+		return fmt.Sprintf("phase:%d", event.Span), "phase"
+	case strings.HasPrefix(event.Type, "task."):
+		return fmt.Sprintf("task:%s#%s", event.Package, event.Name), "task"
+	case event.Type == EventMount:
+		return "", "mount"
+	}
+
+	return "", ""
+}
+
+func micros(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Microsecond)
+}
+
+// Emit implement EventSink
+func (writer *TraceWriter) Emit(event *Event) {
+	writer.Lock()
+	defer writer.Unlock()
+
+	key, cat := spankey(event)
+
+	args := make(map[string]string)
+
+	for name, value := range map[string]string{"package": event.Package, "domain": event.Domain, "message": event.Message, "error": event.Error} {
+		if value != "" {
+			args[name] = value
+		}
+	}
+
+	switch event.Type {
+	case EventPhaseStart:
+
+		// the phases with the same name may run concurrently, e.g: cloning packages,
+		// so they are keyed by the phase id
+		writer.spans[key] = traceSpan{start: event.Time, track: writer.phases.acquire()}
+
+	case EventTaskStart:
+
+		writer.spans[key] = traceSpan{start: event.Time, track: writer.tasks.acquire()}
+
+	case EventPhaseFinish, EventPhaseFail, EventTaskFinish, EventTaskFail:
+
+		span, ok := writer.spans[key]
+
+		if !ok {
+			span = traceSpan{start: event.Time.Add(-event.Elapsed), track: writer.phases.first}
+
+			if cat == "task" {
+				span.track = writer.tasks.first
+			}
+		} else {
+			delete(writer.spans, key)
+
+			if cat == "task" {
+				writer.tasks.release(span.track)
+			} else {
+				writer.phases.release(span.track)
+			}
+		}
+
+		writer.write(&traceEvent{
+			Name: event.Name,
+			Cat:  cat,
+			Ph:   "X",
+			Ts:   micros(span.start),
+			Dur:  micros(event.Time) - micros(span.start),
+			Pid:  writer.pid,
+			Tid:  span.track,
+			Args: args,
+		})
+
+	case EventMount, EventTaskRetry:
+
+		track := writer.phases.first
+
+		if span, ok := writer.spans[key]; ok {
+			track = span.track
+		}
+
+		name := event.Name
+
+		if event.Type == EventTaskRetry {
+			name = event.Name + " (failed attempt)"
+		}
+
+		writer.write(&traceEvent{
+			Name: name,
+			Cat:  cat,
+			Ph:   "X",
+			Ts:   micros(event.Time.Add(-event.Elapsed)),
+			Dur:  int64(event.Elapsed / time.Microsecond),
+			Pid:  writer.pid,
+			Tid:  track,
+			Args: args,
+		})
+
+	case EventTaskSkip:
+
+		writer.write(&traceEvent{
+			Name:  event.Name + " (skipped)",
+			Cat:   cat,
+			Ph:    "i",
+			Ts:    micros(event.Time),
+			Pid:   writer.pid,
+			Tid:   1,
+			Scope: "t",
+			Args:  args,
+		})
+	}
+}
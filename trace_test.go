@@ -0,0 +1,80 @@
+package gsmake
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTraceSpans(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "trace.json")
+
+	writer, err := OpenTrace(file, "cli")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+
+	// two concurrent phases with the same name and a task running meanwhile
+	writer.Emit(&Event{Time: start, Type: EventPhaseStart, Name: "git clone", Span: 1})
+	writer.Emit(&Event{Time: start.Add(time.Second), Type: EventPhaseStart, Name: "git clone", Span: 2})
+	writer.Emit(&Event{Time: start.Add(time.Second), Type: EventTaskStart, Name: "compile", Package: "github.com/gsmake/test"})
+	writer.Emit(&Event{Time: start.Add(2 * time.Second), Type: EventPhaseFinish, Name: "git clone", Span: 1})
+	writer.Emit(&Event{Time: start.Add(4 * time.Second), Type: EventPhaseFinish, Name: "git clone", Span: 2})
+	writer.Emit(&Event{Time: start.Add(4 * time.Second), Type: EventTaskFinish, Name: "compile", Package: "github.com/gsmake/test"})
+
+	writer.file.Close()
+
+	content, err := ioutil.ReadFile(file)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var events []traceEvent
+
+	if err := json.Unmarshal([]byte(strings.TrimSuffix(string(content), ",\n")+"]"), &events); err != nil {
+		t.Fatalf("unmarshal trace error :%s\n%s", err, content)
+	}
+
+	var spans []traceEvent
+
+	for _, event := range events {
+		if event.Ph == "X" {
+			spans = append(spans, event)
+		}
+	}
+
+	if len(spans) != 3 {
+		t.Fatalf("expect 3 spans, got %v", spans)
+	}
+
+	clone1, clone2, compile := spans[0], spans[1], spans[2]
+
+	if clone1.Dur != int64(2*time.Second/time.Microsecond) || clone2.Dur != int64(3*time.Second/time.Microsecond) {
+		t.Fatalf("phase spans overwrite each other :%v %v", clone1, clone2)
+	}
+
+	if clone1.Tid == clone2.Tid {
+		t.Fatalf("concurrent phases share track %d", clone1.Tid)
+	}
+
+	if compile.Tid == clone1.Tid || compile.Tid == clone2.Tid {
+		t.Fatalf("task shares track %d with phases", compile.Tid)
+	}
+}
@@ -0,0 +1,213 @@
+package gsmake
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gsdocker/gserrors"
+)
+
+// Errors .
+var (
+	ErrVersion = errors.New("gsmake version error")
+)
+
+// Core the gsmake core requirement of root package
+type Core struct {
+	Version string // the gsmake core version mounted for the runner, default is VersionGSMake, the major version must be the cli's
+	Require string // the version range the gsmake cli must satisfy, e.g: ">=2.0 <3.0"
+}
+
+var versionRegexp = regexp.MustCompile(`\d+(\.\d+)*`)
+
+// parseVersion extract numeric version from scm version string, e.g: release/v2.0 -> [2 0]
+func parseVersion(version string) ([]int, bool) {
+
+	match := versionRegexp.FindString(version)
+
+	if match == "" {
+		return nil, false
+	}
+
+	var result []int
+
+	for _, v := range strings.Split(match, ".") {
+
+		n, err := strconv.Atoi(v)
+
+		if err != nil {
+			return nil, false
+		}
+
+		result = append(result, n)
+	}
+
+	return result, true
+}
+
+func compareVersion(lhs, rhs []int) int {
+
+	for i := 0; i < len(lhs) || i < len(rhs); i++ {
+
+		var l, r int
+
+		if i < len(lhs) {
+			l = lhs[i]
+		}
+
+		if i < len(rhs) {
+			r = rhs[i]
+		}
+
+		if l < r {
+			return -1
+		}
+
+		if l > r {
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// isOperator check if c is version range operator char
+func isOperator(c rune) bool {
+	return c == '>' || c == '<' || c == '=' || c == '^'
+}
+
+// splitConstraints split version range into constraints, the operator may be separated from its version by spaces
+func splitConstraints(versionRange string) ([]string, error) {
+
+	tokens := strings.FieldsFunc(versionRange, func(c rune) bool {
+		return c == ' ' || c == ','
+	})
+
+	var constraints []string
+
+	for i := 0; i < len(tokens); i++ {
+
+		constraint := tokens[i]
+
+		if strings.TrimLeftFunc(constraint, isOperator) == "" {
+
+			if i+1 == len(tokens) {
+				return nil, gserrors.Newf(ErrVersion, "invalid version range :%s", versionRange)
+			}
+
+			i++
+
+			constraint += tokens[i]
+		}
+
+		constraints = append(constraints, constraint)
+	}
+
+	return constraints, nil
+}
+
+// MatchVersion check if version satisfies the version range,
+// range is a space or comma separated constraint list, the constraint operators are: >= > <= < = ^,
+// ^ means the same major version and not less than the constraint version
+func MatchVersion(version string, versionRange string) (bool, error) {
+
+	current, ok := parseVersion(version)
+
+	if !ok {
+		return false, gserrors.Newf(ErrVersion, "invalid version :%s", version)
+	}
+
+	constraints, err := splitConstraints(versionRange)
+
+	if err != nil {
+		return false, err
+	}
+
+	for _, constraint := range constraints {
+
+		op := constraint[:len(constraint)-len(strings.TrimLeftFunc(constraint, isOperator))]
+
+		target, ok := parseVersion(constraint[len(op):])
+
+		if !ok {
+			return false, gserrors.Newf(ErrVersion, "invalid version range :%s", versionRange)
+		}
+
+		result := compareVersion(current, target)
+
+		var matched bool
+
+		switch op {
+		case ">=":
+			matched = result >= 0
+		case ">":
+			matched = result > 0
+		case "<=":
+			matched = result <= 0
+		case "<":
+			matched = result < 0
+		case "=", "":
+			matched = result == 0
+		case "^":
+			matched = result >= 0 && current[0] == target[0]
+		default:
+			return false, gserrors.Newf(ErrVersion, "invalid version range operator %s :%s", op, versionRange)
+		}
+
+		if !matched {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// coreVersion get the gsmake core version mounted for the runner,
+// returns error if the installed gsmake cli is incompatible with the package's requirement.
+// The pinned core version can't have another major version, even an older one: the runner code is generated
+// by the cli, the package must require a cli of the core's major version instead
+func coreVersion(pkg *Package) (string, error) {
+
+	if pkg.GSMake == nil {
+		return VersionGSMake, nil
+	}
+
+	if pkg.GSMake.Require != "" {
+
+		ok, err := MatchVersion(VersionGSMake, pkg.GSMake.Require)
+
+		if err != nil {
+			return "", err
+		}
+
+		if !ok {
+			return "", gserrors.Newf(
+				ErrVersion,
+				"installed gsmake %s is incompatible with package %s\n\trequire gsmake :%s",
+				VersionGSMake, pkg.Name, pkg.GSMake.Require,
+			)
+		}
+	}
+
+	if pkg.GSMake.Version == "" {
+		return VersionGSMake, nil
+	}
+
+	// the runner code is generated by cli, so the core major version must be the same as cli's
+	if core, ok := parseVersion(pkg.GSMake.Version); ok {
+
+		cli, _ := parseVersion(VersionGSMake)
+
+		if core[0] != cli[0] {
+			return "", gserrors.Newf(
+				ErrVersion,
+				"installed gsmake %s can't generate runner for gsmake core %s\n\tpackage :%s",
+				VersionGSMake, pkg.GSMake.Version, pkg.Name,
+			)
+		}
+	}
+
+	return pkg.GSMake.Version, nil
+}
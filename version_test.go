@@ -0,0 +1,71 @@
+package gsmake
+
+import "testing"
+
+func TestMatchVersion(t *testing.T) {
+
+	cases := []struct {
+		version string
+		require string
+		expect  bool
+	}{
+		{"release/v2.0", ">=2.0 <3.0", true},
+		{"release/v2.0", ">2.0", false},
+		{"v2.1.3", "^2.1", true},
+		{"v3.0", "^2.1", false},
+		{"v2.0", "2", true},
+		{"v2.0", ">=1.2,<2", false},
+		{"release/v2.0", ">= v2.0, < v3.0", true},
+		{"release/v2.0", "^ 2.1", false},
+	}
+
+	for _, c := range cases {
+
+		ok, err := MatchVersion(c.version, c.require)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok != c.expect {
+			t.Fatalf("match %s with %s expect %v", c.version, c.require, c.expect)
+		}
+	}
+
+	for _, require := range []string{">=x", ">=2.0 <", "=>> 2.0"} {
+		if _, err := MatchVersion("v2.0", require); err == nil {
+			t.Fatalf("expect invalid version range error :%s", require)
+		}
+	}
+}
+
+func TestCoreVersion(t *testing.T) {
+
+	cases := []struct {
+		core   *Core
+		expect string
+	}{
+		{nil, VersionGSMake},
+		{&Core{Require: ">= 2.0"}, VersionGSMake},
+		{&Core{Version: "release/v2.1"}, "release/v2.1"},
+		{&Core{Version: "release/v1.0"}, ""},
+		{&Core{Require: ">=3.0"}, ""},
+	}
+
+	for _, c := range cases {
+
+		version, err := coreVersion(&Package{Name: "github.com/gsmake/test", GSMake: c.core})
+
+		if c.expect == "" {
+			if err == nil {
+				t.Fatalf("expect incompatible core error :%v", c.core)
+			}
+
+			continue
+		}
+
+		if err != nil || version != c.expect {
+			t.Fatalf("expect core version %s, got %s %v", c.expect, version, err)
+		}
+	}
+}
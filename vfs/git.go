@@ -3,6 +3,7 @@ package vfs
 import (
 	"bytes"
 	"errors"
+	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -136,112 +137,97 @@ func (gitFS *GitFS) clone(remote, rundir, dirname string, bare bool) error {
 		}
 	}
 
-	var cmd *exec.Cmd
+	args := []string{"clone", remote, dirname}
 
-	cmd = exec.Command("git", "clone", remote, dirname)
-
-	if !bare {
-		cmd = exec.Command("git", "clone", remote, dirname)
-	} else {
-		cmd = exec.Command("git", "clone", "--mirror", remote, dirname)
+	if bare {
+		args = []string{"clone", "--mirror", remote, dirname}
 	}
 
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
+	finish := span("git clone", remote)
 
-	cmd.Dir = rundir
+	err := gitFS.git(rundir, args...)
 
-	return cmd.Run()
-}
-
-func (gitFS *GitFS) setRemote(rundir string, name string, url string) error {
+	finish(err)
 
-	gitFS.D("change remote :\n\trepo:%s\n\tname:%s\n\turl:%s", rundir, name, url)
+	return err
+}
 
-	cmd := exec.Command("git", "remote")
+// git run git command in rundir, the output is streamed to console and the stderr is also captured into error
+func (gitFS *GitFS) git(rundir string, args ...string) error {
 
-	var buff bytes.Buffer
+	cmd := exec.Command("git", args...)
 
-	cmd.Stdout = &buff
+	var stderr bytes.Buffer
 
-	cmd.Stderr = os.Stderr
+	cmd.Stderr = io.MultiWriter(os.Stderr, &stderr)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
 
 	cmd.Dir = rundir
 
-	err := cmd.Run()
-
-	if err != nil {
-		return err
+	if err := cmd.Run(); err != nil {
+		return gserrors.Newf(err, "git %s error\n\trepo :%s\n%s", strings.Join(args, " "), rundir, stderr.String())
 	}
 
-	if !strings.Contains(buff.String(), name) {
-
-		cmd = exec.Command("git", "remote", "add", name, url)
+	return nil
+}
 
-		cmd.Stderr = os.Stderr
-		cmd.Stdin = os.Stdin
-		cmd.Stdout = os.Stdout
+// output run git command in rundir quietly and get the stdout
+func (gitFS *GitFS) output(rundir string, args ...string) (string, error) {
 
-		cmd.Dir = rundir
+	cmd := exec.Command("git", args...)
 
-		return cmd.Run()
-	}
+	var stdout, stderr bytes.Buffer
 
-	cmd = exec.Command("git", "remote", "set-url", name, url)
-
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
 
 	cmd.Dir = rundir
 
-	return cmd.Run()
+	if err := cmd.Run(); err != nil {
+		return "", gserrors.Newf(err, "git %s error\n\trepo :%s\n%s", strings.Join(args, " "), rundir, stderr.String())
+	}
+
+	return stdout.String(), nil
 }
 
-func (gitFS *GitFS) fetch(rundir string) error {
+func (gitFS *GitFS) setRemote(rundir string, name string, url string) error {
 
-	gitFS.D("git remote update :%s", rundir)
+	gitFS.D("change remote :\n\trepo:%s\n\tname:%s\n\turl:%s", rundir, name, url)
 
-	cmd := exec.Command("git", "remote", "update")
+	remotes, err := gitFS.output(rundir, "remote")
 
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
+	if err != nil {
+		return err
+	}
 
-	cmd.Dir = rundir
+	if !strings.Contains(remotes, name) {
+		return gitFS.git(rundir, "remote", "add", name, url)
+	}
 
-	return cmd.Run()
+	return gitFS.git(rundir, "remote", "set-url", name, url)
 }
 
-func (gitFS *GitFS) pull(rundir string) error {
-
-	cmd := exec.Command("git", "pull")
+func (gitFS *GitFS) fetch(rundir string) error {
 
-	cmd.Stderr = os.Stderr
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
+	gitFS.D("git remote update :%s", rundir)
 
-	cmd.Dir = rundir
+	return gitFS.git(rundir, "remote", "update")
+}
 
-	return cmd.Run()
+func (gitFS *GitFS) pull(rundir string) error {
+	return gitFS.git(rundir, "pull")
 }
 
 func (gitFS *GitFS) checkout(rundir string, version string) error {
 
-	cmd := exec.Command("git", "checkout", version)
+	finish := span("git checkout", version)
 
-	var buff bytes.Buffer
+	_, err := gitFS.output(rundir, "checkout", version)
 
-	cmd.Stderr = &buff
+	finish(err)
 
-	cmd.Dir = rundir
-
-	if err := cmd.Run(); err != nil {
-		return gserrors.Newf(err, buff.String())
-	}
-
-	return nil
+	return err
 }
 
 // Dismount implement UserFS
@@ -0,0 +1,380 @@
+package vfs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gsdocker/gserrors"
+	"github.com/gsdocker/gslogger"
+	"github.com/gsdocker/gsos/fs"
+)
+
+// ErrStatic .
+var (
+	ErrStatic = errors.New("static fs error")
+)
+
+// snapshot layout
+const (
+	SnapshotIndexer   = "mount.json"
+	SnapshotUserspace = "userspace"
+)
+
+// SnapshotEntry snapshot mount indexer entry
+type SnapshotEntry struct {
+	Target string // target vfs url
+	Path   string // snapshot relative path, empty means the processing package
+}
+
+// StaticFS read-only rootfs backed by a userspace snapshot, it's used by the relocatable runner
+type StaticFS struct {
+	gslogger.Log                          // Mixin Log APIs
+	rootpath     string                   // snapshot root path
+	targetpath   string                   // the processing package path
+	indexer      map[string]SnapshotEntry // mount indexer
+	tempdir      string                   // per-process temp dir, created by the first TempDir call
+	tempOnce     sync.Once                // temp dir create once
+}
+
+// NewStatic create rootfs from snapshot which is created by Snapshot function
+func NewStatic(rootpath string, targetpath string) (RootFS, error) {
+
+	fullpath, err := filepath.Abs(rootpath)
+
+	if err != nil {
+		return nil, gserrors.Newf(err, "get abs path error\n\t%s", rootpath)
+	}
+
+	targetfullpath, err := filepath.Abs(targetpath)
+
+	if err != nil {
+		return nil, gserrors.Newf(err, "get abs path error\n\t%s", targetpath)
+	}
+
+	indexerfile := filepath.Join(fullpath, SnapshotIndexer)
+
+	content, err := ioutil.ReadFile(indexerfile)
+
+	if err != nil {
+		return nil, gserrors.Newf(err, "read snapshot indexer error\n\t%s", indexerfile)
+	}
+
+	rootfs := &StaticFS{
+		Log:        gslogger.Get("vfs"),
+		rootpath:   fullpath,
+		targetpath: targetfullpath,
+	}
+
+	if err := json.Unmarshal(content, &rootfs.indexer); err != nil {
+		return nil, gserrors.Newf(err, "unmarshal snapshot indexer error\n\t%s", indexerfile)
+	}
+
+	return rootfs, nil
+}
+
+func (rootfs *StaticFS) readonly(action string) error {
+	return gserrors.Newf(ErrStatic, "%s not supported by read-only snapshot rootfs\n\t%s", action, rootfs.rootpath)
+}
+
+func (rootfs *StaticFS) entry(v SnapshotEntry) (*Entry, *Entry, error) {
+
+	target, err := url.Parse(v.Target)
+
+	if err != nil {
+		return nil, nil, gserrors.Newf(err, "parse url error:%s", v.Target)
+	}
+
+	targetE := &Entry{URL: target}
+
+	if v.Path == "" {
+		targetE.Mapping = rootfs.targetpath
+	} else {
+		targetE.Mapping = filepath.Join(rootfs.rootpath, filepath.FromSlash(v.Path))
+	}
+
+	src, err := url.Parse(fmt.Sprintf("%s://%s?version=current", FSFile, filepath.ToSlash(targetE.Mapping)))
+
+	if err != nil {
+		return nil, nil, gserrors.Newf(err, "parse url error:%s", targetE.Mapping)
+	}
+
+	return &Entry{URL: src, Mapping: targetE.Mapping}, targetE, nil
+}
+
+// RootPath implement RootFS
+func (rootfs *StaticFS) RootPath() string {
+	return rootfs.rootpath
+}
+
+// TargetPath implement RootFS
+func (rootfs *StaticFS) TargetPath() string {
+	return rootfs.targetpath
+}
+
+// Userspace implement RootFS
+func (rootfs *StaticFS) Userspace() string {
+	return filepath.Join(rootfs.rootpath, SnapshotUserspace)
+}
+
+// Mounted implement RootFS
+func (rootfs *StaticFS) Mounted(src string, target string) bool {
+	_, _, err := rootfs.Open(target)
+
+	return err == nil
+}
+
+// Mount implement RootFS
+func (rootfs *StaticFS) Mount(src, target string) error {
+	return rootfs.readonly("mount")
+}
+
+// Dismount implement RootFS
+func (rootfs *StaticFS) Dismount(target string) error {
+	return rootfs.readonly("dismount")
+}
+
+// List implement RootFS
+func (rootfs *StaticFS) List(f func(src *Entry, target *Entry) bool) error {
+
+	for _, v := range rootfs.indexer {
+
+		src, target, err := rootfs.entry(v)
+
+		if err != nil {
+			return err
+		}
+
+		if !f(src, target) {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+// Open implement RootFS
+func (rootfs *StaticFS) Open(target string) (*Entry, *Entry, error) {
+
+	u, err := url.Parse(target)
+
+	if err != nil {
+		return nil, nil, gserrors.Newf(err, "parse url error:%s", target)
+	}
+
+	if u.Scheme != FSGSMake {
+		return nil, nil, gserrors.Newf(ErrURL, "open target must be vfs url\n%s", target)
+	}
+
+	key := fmt.Sprintf("%s/%s%s", u.Query().Get("domain"), u.Host, u.Path)
+
+	v, ok := rootfs.indexer[key]
+
+	if !ok {
+		return nil, nil, gserrors.Newf(ErrNotFound, "mount info not found: %s", target)
+	}
+
+	return rootfs.entry(v)
+}
+
+// Update implement RootFS
+func (rootfs *StaticFS) Update(src string, nocache bool) error {
+	return rootfs.readonly("update")
+}
+
+// UpdateAll implement RootFS
+func (rootfs *StaticFS) UpdateAll(nocache bool) error {
+	return rootfs.readonly("update")
+}
+
+// UpdateCache implement RootFS
+func (rootfs *StaticFS) UpdateCache(src string) error {
+	return rootfs.readonly("update cache")
+}
+
+// Clear implement RootFS, only the temp dir is removed
+func (rootfs *StaticFS) Clear() error {
+
+	if rootfs.tempdir == "" {
+		return nil
+	}
+
+	if err := os.RemoveAll(rootfs.tempdir); err != nil {
+		return gserrors.Newf(err, "remove temp dir error\n\t%s", rootfs.tempdir)
+	}
+
+	return nil
+}
+
+// CacheRoot implement RootFS
+func (rootfs *StaticFS) CacheRoot(src *Entry) string {
+	return filepath.Join(rootfs.rootpath, "cache", src.Scheme, src.Host, src.Path)
+}
+
+// Cached implement RootFS
+func (rootfs *StaticFS) Cached(src *Entry) error {
+	return rootfs.readonly("cache")
+}
+
+// Protocol implement RootFS
+func (rootfs *StaticFS) Protocol(host string) string {
+	return "git"
+}
+
+// TempDir implement RootFS, the snapshot is read-only and may be shared by concurrent runners,
+// so the temp dir is created per process under the system temp dir
+func (rootfs *StaticFS) TempDir(domain string) string {
+
+	rootfs.tempOnce.Do(func() {
+
+		dir, err := ioutil.TempDir("", "gsmake-static")
+
+		if err != nil {
+			rootfs.W("create temp dir error :%s", err)
+			dir = filepath.Join(os.TempDir(), fmt.Sprintf("gsmake-static-%d", os.Getpid()))
+		}
+
+		rootfs.tempdir = dir
+	})
+
+	return filepath.Join(rootfs.tempdir, domain, "tmp")
+}
+
+// DomainDir implement RootFS
+func (rootfs *StaticFS) DomainDir(domain string) string {
+	return filepath.Join(rootfs.Userspace(), domain)
+}
+
+// Redirect implement RootFS
+func (rootfs *StaticFS) Redirect(from, to string, enable bool) error {
+	return rootfs.readonly("redirect")
+}
+
+// Snapshot copy all mounted packages of rootfs into output directory,
+// the processing package itself is not copied and is resolved by the StaticFS's targetpath
+func Snapshot(rootfs RootFS, output string) error {
+
+	indexer := make(map[string]SnapshotEntry)
+
+	var err error
+
+	listErr := rootfs.List(func(src, target *Entry) bool {
+
+		key := fmt.Sprintf("%s/%s", target.Domain(), target.Name())
+
+		if src.Scheme == FSFile && filepath.Clean(fmt.Sprintf("%s%s", src.Host, src.Path)) == rootfs.TargetPath() {
+			indexer[key] = SnapshotEntry{Target: target.String()}
+			return true
+		}
+
+		path := filepath.Join(SnapshotUserspace, target.Domain(), "src", target.Host, target.Path)
+
+		rootfs.D("snapshot package :%s", target)
+
+		if err = copytree(target.Mapping, filepath.Join(output, path)); err != nil {
+			return false
+		}
+
+		indexer[key] = SnapshotEntry{Target: target.String(), Path: filepath.ToSlash(path)}
+
+		return true
+	})
+
+	if listErr != nil {
+		return listErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(indexer, "", "\t")
+
+	if err != nil {
+		return gserrors.Newf(err, "marshal snapshot indexer error")
+	}
+
+	indexerfile := filepath.Join(output, SnapshotIndexer)
+
+	if err := ioutil.WriteFile(indexerfile, content, 0644); err != nil {
+		return gserrors.Newf(err, "write snapshot indexer error\n\t%s", indexerfile)
+	}
+
+	return nil
+}
+
+// copytree copy directory tree and dereference symlinks, the scm metadata directory is skipped
+func copytree(src, dst string) error {
+
+	infos, err := ioutil.ReadDir(src)
+
+	if err != nil {
+		return gserrors.Newf(err, "read dir error\n\t%s", src)
+	}
+
+	if err := fs.MkdirAll(dst, 0755); err != nil {
+		return gserrors.Newf(err, "create dir error\n\t%s", dst)
+	}
+
+	for _, info := range infos {
+
+		if info.Name() == ".git" {
+			continue
+		}
+
+		srcpath := filepath.Join(src, info.Name())
+		dstpath := filepath.Join(dst, info.Name())
+
+		// follow symlinks
+		info, err := os.Stat(srcpath)
+
+		if err != nil {
+			return gserrors.Newf(err, "stat file error\n\t%s", srcpath)
+		}
+
+		if info.IsDir() {
+			if err := copytree(srcpath, dstpath); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if err := copyfile(srcpath, dstpath, info.Mode()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func copyfile(src, dst string, mode os.FileMode) error {
+
+	in, err := os.Open(src)
+
+	if err != nil {
+		return gserrors.Newf(err, "open file error\n\t%s", src)
+	}
+
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+
+	if err != nil {
+		return gserrors.Newf(err, "create file error\n\t%s", dst)
+	}
+
+	defer out.Close()
+
+	if _, err := io.Copy(out, in); err != nil {
+		return gserrors.Newf(err, "copy file error\n\tsrc: %s\n\ttarget: %s", src, dst)
+	}
+
+	return nil
+}
@@ -0,0 +1,159 @@
+package vfs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gsdocker/gsos/fs"
+)
+
+func writefiles(t *testing.T, root string, files map[string]string) {
+
+	for name, content := range files {
+
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	target := filepath.Join(dir, "target")
+	dep := filepath.Join(dir, "dep")
+	output := filepath.Join(dir, "snapshot")
+
+	writefiles(t, target, map[string]string{".gsmake.json": `{"name":"github.com/gsmake/test"}`})
+
+	writefiles(t, dep, map[string]string{
+		".gsmake.json": `{"name":"github.com/gsmake/dep"}`,
+		"src/dep.go":   "package dep\n",
+		".git/HEAD":    "ref: refs/heads/master\n",
+	})
+
+	rootfs, err := New(filepath.Join(dir, "root"), target)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for src, target := range map[string]string{
+		fmt.Sprintf("file://%s?version=current", target): "gsmake://github.com/gsmake/test?domain=task",
+		fmt.Sprintf("file://%s?version=current", dep):    "gsmake://github.com/gsmake/dep?domain=golang",
+	} {
+		if err := rootfs.Mount(src, target); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Snapshot(rootfs, output); err != nil {
+		t.Fatal(err)
+	}
+
+	static, err := NewStatic(output, target)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the processing package is resolved by target path, the others are copied without scm metadata
+	_, entry, err := static.Open("gsmake://github.com/gsmake/test?domain=task")
+
+	if err != nil || entry.Mapping != target {
+		t.Fatalf("expect processing package mapping %s, got %v %v", target, entry, err)
+	}
+
+	_, entry, err = static.Open("gsmake://github.com/gsmake/dep?domain=golang")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !fs.Exists(filepath.Join(entry.Mapping, "src", "dep.go")) || fs.Exists(filepath.Join(entry.Mapping, ".git")) {
+		t.Fatalf("unexpected snapshot package content :%s", entry.Mapping)
+	}
+
+	if rel, err := filepath.Rel(output, entry.Mapping); err != nil || rel == entry.Mapping || rel[0] == '.' {
+		t.Fatalf("expect package snapshot under %s, got %s", output, entry.Mapping)
+	}
+
+	if _, _, err := static.Open("gsmake://github.com/gsmake/dep?domain=task"); !NotFound(err) {
+		t.Fatalf("expect not found error, got %v", err)
+	}
+
+	count := 0
+
+	static.List(func(src, target *Entry) bool {
+		count++
+		return true
+	})
+
+	if count != 2 {
+		t.Fatalf("expect 2 snapshot entries, got %d", count)
+	}
+
+	if err := static.Mount("file:///tmp?version=current", "gsmake://github.com/gsmake/tmp?domain=task"); err == nil {
+		t.Fatal("expect read-only snapshot rootfs")
+	}
+}
+
+func TestStaticTempDir(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "gsmake-test")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	writefiles(t, dir, map[string]string{SnapshotIndexer: "{}"})
+
+	rootfs1, err := NewStatic(dir, dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rootfs2, err := NewStatic(dir, dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempdir := rootfs1.TempDir("task")
+
+	if tempdir != rootfs1.TempDir("task") || tempdir == rootfs2.TempDir("task") {
+		t.Fatalf("expect stable temp dir per rootfs, got %s and %s", tempdir, rootfs2.TempDir("task"))
+	}
+
+	for _, rootfs := range []RootFS{rootfs1, rootfs2} {
+
+		base := filepath.Dir(filepath.Dir(rootfs.TempDir("task")))
+
+		if err := rootfs.Clear(); err != nil {
+			t.Fatal(err)
+		}
+
+		if fs.Exists(base) {
+			t.Fatalf("expect temp dir removed :%s", base)
+		}
+	}
+}
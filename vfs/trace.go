@@ -0,0 +1,20 @@
+package vfs
+
+// Tracer start a span of vfs operation, e.g: git clone, and returns the function finishes the span
+type Tracer func(name string, message string) func(err error)
+
+var tracer Tracer
+
+// Trace set the tracer of vfs operations
+func Trace(t Tracer) {
+	tracer = t
+}
+
+func span(name string, message string) func(err error) {
+
+	if tracer == nil {
+		return func(err error) {}
+	}
+
+	return tracer(name, message)
+}
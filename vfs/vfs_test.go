@@ -39,16 +39,15 @@ func TestGitMount(t *testing.T) {
 		t.Fatal("open not exists file error")
 	}
 
-	entries, err := rootfs.List()
+	err = rootfs.List(func(src, target *Entry) bool {
+		fmt.Printf("%s -> %s\n", src, target)
+		return true
+	})
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	for k, v := range entries {
-		fmt.Printf("%s -> %s\n", k, v)
-	}
-
 	err = rootfs.Clear()
 
 	if err != nil {
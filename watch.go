@@ -0,0 +1,351 @@
+package gsmake
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gsdocker/gserrors"
+	"github.com/gsdocker/gslogger"
+	"github.com/gsmake/gsmake/vfs"
+)
+
+// watch mode poll interval and debounce duration
+const (
+	watchPollInterval = 500 * time.Millisecond
+	watchDebounce     = 300 * time.Millisecond
+)
+
+// WatchConfig package watch mode config
+type WatchConfig struct {
+	Ignore []string // ignore file globs, relative to the package path
+}
+
+// fileStat watched file stat
+type fileStat struct {
+	size    int64 // file size
+	modtime int64 // modify time
+}
+
+// watchRoot watched package dir
+type watchRoot struct {
+	path   string           // package path
+	ignore []*regexp.Regexp // ignore globs
+}
+
+// Watcher rerun tasks when the files of processing package or local mounted packages changed,
+// the runner is recompiled if any manifest or task source changed
+type Watcher struct {
+	gslogger.Log               // Mixin Log APIs
+	sync.Mutex                 // compiler locker
+	rootfs       vfs.RootFS    // vfs
+	imports      []Import      // extra imports
+	startdir     string        // runner start dir
+	args         []string      // runner args
+	compiler     *AOTCompiler  // current compiler
+	roots        []*watchRoot  // watched package dirs
+	closed       chan struct{} // close notify chan
+	closeOnce    sync.Once     // close once
+}
+
+// NewWatcher create watcher which runs runner with args in startdir
+func NewWatcher(rootfs vfs.RootFS, imports []Import, startdir string, args []string) *Watcher {
+	return &Watcher{
+		Log:      gslogger.Get("watch"),
+		rootfs:   rootfs,
+		imports:  imports,
+		startdir: startdir,
+		args:     args,
+		closed:   make(chan struct{}),
+	}
+}
+
+// Close stop watching, the running runner is interrupted
+func (watcher *Watcher) Close() {
+
+	watcher.closeOnce.Do(func() {
+
+		close(watcher.closed)
+
+		watcher.Lock()
+		compiler := watcher.compiler
+		watcher.Unlock()
+
+		if compiler != nil {
+			compiler.Signal(os.Interrupt)
+		}
+	})
+}
+
+func (watcher *Watcher) stopped() bool {
+	select {
+	case <-watcher.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+// compile compile runner and refresh watched package dirs
+func (watcher *Watcher) compile() error {
+
+	compiler, err := Compile(watcher.rootfs, watcher.imports)
+
+	if err != nil {
+		return err
+	}
+
+	watcher.Lock()
+	watcher.compiler = compiler
+	watcher.Unlock()
+
+	roots, err := watcher.watchroots(compiler)
+
+	if err != nil {
+		return err
+	}
+
+	watcher.roots = roots
+
+	return nil
+}
+
+// watchroots get the processing package and local mounted package dirs, the ignore globs are
+// the manifest declared ones and the declared outputs of tasks, so the task outputs never trigger rerun
+func (watcher *Watcher) watchroots(compiler *AOTCompiler) ([]*watchRoot, error) {
+
+	var patterns []string
+
+	for _, pkg := range compiler.packages {
+		for _, task := range pkg.Task {
+			patterns = append(patterns, task.Outputs...)
+		}
+	}
+
+	paths := []string{watcher.rootfs.TargetPath()}
+
+	err := watcher.rootfs.List(func(src, target *vfs.Entry) bool {
+
+		if src.Scheme == vfs.FSFile {
+			paths = append(paths, filepath.Clean(src.Host+src.Path))
+		}
+
+		return true
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+
+	var roots []*watchRoot
+
+	for i, path := range paths {
+
+		if i > 0 && paths[i-1] == path {
+			continue
+		}
+
+		root := &watchRoot{path: path}
+
+		ignore := patterns
+
+		if pkg, err := loadjson(filepath.Join(path, ".gsmake.json")); err == nil && pkg.Watch != nil {
+			ignore = append(ignore, pkg.Watch.Ignore...)
+		}
+
+		for _, pattern := range ignore {
+
+			matcher, err := globRegexp(pattern)
+
+			if err != nil {
+				return nil, gserrors.Newf(err, "invalid watch ignore glob :%s", pattern)
+			}
+
+			root.ignore = append(root.ignore, matcher)
+		}
+
+		roots = append(roots, root)
+	}
+
+	return roots, nil
+}
+
+// scan get the stats of watched files, indexed by full path
+func (watcher *Watcher) scan() map[string]fileStat {
+
+	stats := make(map[string]fileStat)
+
+	for _, root := range watcher.roots {
+
+		filepath.Walk(root.path, func(path string, info os.FileInfo, err error) error {
+
+			if err != nil {
+				return nil
+			}
+
+			if info.IsDir() {
+				if info.Name() == ".git" {
+					return filepath.SkipDir
+				}
+
+				return nil
+			}
+
+			rel, err := filepath.Rel(root.path, path)
+
+			if err != nil {
+				return nil
+			}
+
+			rel = filepath.ToSlash(rel)
+
+			for _, matcher := range root.ignore {
+				if matcher.MatchString(rel) {
+					return nil
+				}
+			}
+
+			stats[path] = fileStat{size: info.Size(), modtime: info.ModTime().UnixNano()}
+
+			return nil
+		})
+	}
+
+	return stats
+}
+
+// changes get the changed files between two scans
+func changes(last, current map[string]fileStat) []string {
+
+	var files []string
+
+	for path, stat := range current {
+		if laststat, ok := last[path]; !ok || laststat != stat {
+			files = append(files, path)
+		}
+	}
+
+	for path := range last {
+		if _, ok := current[path]; !ok {
+			files = append(files, path)
+		}
+	}
+
+	sort.Strings(files)
+
+	return files
+}
+
+// manifest check if file is package manifest or task source
+func manifest(path string) bool {
+	return filepath.Base(path) == ".gsmake.json" ||
+		(filepath.Base(filepath.Dir(path)) == ".gsmake" && strings.HasSuffix(path, ".go"))
+}
+
+func (watcher *Watcher) run() {
+
+	watcher.Lock()
+	compiler := watcher.compiler
+	watcher.Unlock()
+
+	watcher.I("run %s ...", strings.Join(watcher.args, " "))
+
+	startime := time.Now()
+
+	if err := compiler.Run(watcher.startdir, watcher.args...); err != nil {
+		watcher.E("run %s error\n%s", strings.Join(watcher.args, " "), err)
+		return
+	}
+
+	watcher.I("run %s -- success %s", strings.Join(watcher.args, " "), time.Now().Sub(startime))
+}
+
+// wait wait for file changes until the changes settle down, returns nil if watcher closed
+func (watcher *Watcher) wait(last map[string]fileStat) []string {
+
+	var changed []string
+
+	interval := watchPollInterval
+
+	for {
+		select {
+		case <-watcher.closed:
+			return nil
+		case <-time.After(interval):
+		}
+
+		current := watcher.scan()
+
+		files := changes(last, current)
+
+		if len(files) == 0 && len(changed) != 0 {
+			return changed
+		}
+
+		changed = append(changed, files...)
+
+		last = current
+
+		if len(changed) != 0 {
+			interval = watchDebounce
+		}
+	}
+}
+
+// Watch run tasks, then rerun them after every file changes until watcher closed
+func (watcher *Watcher) Watch() error {
+
+	if err := watcher.compile(); err != nil {
+		return err
+	}
+
+	for !watcher.stopped() {
+
+		stats := watcher.scan()
+
+		watcher.run()
+
+		watcher.I("watching %d packages for changes ...", len(watcher.roots))
+
+		changed := watcher.wait(stats)
+
+		if changed == nil {
+			break
+		}
+
+		watcher.I("files changed\n\t%s", strings.Join(changed, "\n\t"))
+
+		for _, path := range changed {
+
+			if !manifest(path) {
+				continue
+			}
+
+			watcher.I("manifest changed, recompile runner ...")
+
+			for {
+				err := watcher.compile()
+
+				if err == nil {
+					break
+				}
+
+				watcher.E("recompile runner error, waiting for fix ...\n%s", err)
+
+				if watcher.wait(watcher.scan()) == nil {
+					return nil
+				}
+			}
+
+			break
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package gsmake
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWatchChanges(t *testing.T) {
+
+	last := map[string]fileStat{
+		"/p/a.go": {size: 1, modtime: 1},
+		"/p/b.go": {size: 1, modtime: 1},
+		"/p/c.go": {size: 1, modtime: 1},
+	}
+
+	current := map[string]fileStat{
+		"/p/a.go": {size: 1, modtime: 1},
+		"/p/b.go": {size: 1, modtime: 2},
+		"/p/d.go": {size: 1, modtime: 1},
+	}
+
+	expect := []string{"/p/b.go", "/p/c.go", "/p/d.go"}
+
+	if files := changes(last, current); !reflect.DeepEqual(files, expect) {
+		t.Fatalf("expect changes %v\n\tgot :%v", expect, files)
+	}
+
+	if files := changes(current, current); len(files) != 0 {
+		t.Fatalf("expect no changes, got %v", files)
+	}
+}
+
+func TestWatchManifest(t *testing.T) {
+
+	for path, expect := range map[string]bool{
+		"/p/.gsmake.json":       true,
+		"/p/.gsmake/tasks.go":   true,
+		"/p/.gsmake/README.md":  false,
+		"/p/main.go":            false,
+		"/p/sub/.gsmake.json.1": false,
+	} {
+		if manifest(path) != expect {
+			t.Fatalf("manifest(%s) expect %v", path, expect)
+		}
+	}
+}
+
+func TestWatchIgnore(t *testing.T) {
+
+	runner := newTestRunner(t)
+
+	target := runner.rootfs.TargetPath()
+
+	files := map[string]string{
+		".gsmake.json":     `{"name":"github.com/gsmake/test","watch":{"ignore":["**/*.log"]}}`,
+		"main.go":          "package main\n",
+		"bin/test":         "binary",
+		"logs/run.log":     "log",
+		".git/HEAD":        "ref",
+		"src/pkg/pkg.go":   "package pkg\n",
+		"src/pkg/test.log": "log",
+	}
+
+	for name, content := range files {
+
+		path := filepath.Join(target, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	compiler := &AOTCompiler{
+		packages: map[string]*Package{
+			"github.com/gsmake/test": {Task: map[string]*Task{"build": {Outputs: []string{"bin/**"}}}},
+		},
+	}
+
+	watcher := &Watcher{rootfs: runner.rootfs}
+
+	roots, err := watcher.watchroots(compiler)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	watcher.roots = roots
+
+	var scanned []string
+
+	for path := range watcher.scan() {
+
+		rel, err := filepath.Rel(target, path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		scanned = append(scanned, filepath.ToSlash(rel))
+	}
+
+	// the task outputs, manifest ignore globs and .git dir are not watched
+	expect := map[string]bool{".gsmake.json": true, "main.go": true, "src/pkg/pkg.go": true}
+
+	if len(scanned) != len(expect) {
+		t.Fatalf("expect scanned %v\n\tgot :%v", expect, scanned)
+	}
+
+	for _, rel := range scanned {
+		if !expect[rel] {
+			t.Fatalf("expect scanned %v\n\tgot :%v", expect, scanned)
+		}
+	}
+}